@@ -0,0 +1,228 @@
+package marvin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// AdminConfig configures the admin API, which lets operators poke at a
+// running hub over HTTP:
+//
+//	GET  /components                list buses and reactors, and their state
+//	POST /reactors/{name}/enable    start sending events to a reactor again
+//	POST /reactors/{name}/disable   stop sending events to a reactor
+//	POST /events                    inject an event, as if it came from a bus:
+//	                                {"bus": "...", "text": "...", "address": ..., "sender": "..."}
+//	POST /replies                   send a message to a bus:
+//	                                {"bus": "...", "address": ..., "text": "..."}
+//	POST /shutdown                  shut down the hub
+//
+// If Token is set, every request must carry it as a bearer token. If it
+// isn't, Listen must be a loopback address. Once the hub starts shutting
+// down, it takes no more events, so POST /events returns 503.
+type AdminConfig struct {
+	Listen string
+	Token  string
+}
+
+type adminEventRequest struct {
+	Bus     BusName `json:"bus"`
+	Text    string  `json:"text"`
+	Address any     `json:"address"`
+	Sender  string  `json:"sender"`
+}
+
+type adminReplyRequest struct {
+	Bus     BusName `json:"bus"`
+	Address any     `json:"address"`
+	Text    string  `json:"text"`
+}
+
+func (cfg AdminConfig) validate() error {
+	if cfg.Listen == "" || cfg.Token != "" {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(cfg.Listen)
+	if err != nil {
+		return fmt.Errorf("bad admin listen address: %w", err)
+	}
+
+	if host == "localhost" {
+		return nil
+	}
+
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+
+	return fmt.Errorf("admin API must listen on localhost unless a token is set")
+}
+
+// serveAdmin runs the admin API until ctx is cancelled. Shutting down
+// through the API cancels the hub with shutdown.
+func (h *Hub) serveAdmin(ctx context.Context, shutdown context.CancelFunc) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/components", h.handleAdminComponents)
+	mux.HandleFunc("/reactors/", h.handleAdminReactor)
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		h.handleAdminEvent(ctx, w, r)
+	})
+	mux.HandleFunc("/replies", func(w http.ResponseWriter, r *http.Request) {
+		h.handleAdminReply(ctx, w, r)
+	})
+	mux.HandleFunc("/shutdown", func(w http.ResponseWriter, r *http.Request) {
+		if !requireMethod(w, r, http.MethodPost) {
+			return
+		}
+
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "shutting down"})
+		shutdown()
+	})
+
+	return serve(ctx, "admin API", h.adminConfig.Listen, h.requireToken(mux))
+}
+
+func (h *Hub) requireToken(next http.Handler) http.Handler {
+	if h.adminConfig.Token == "" {
+		return next
+	}
+
+	want := []byte("Bearer " + h.adminConfig.Token)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := []byte(r.Header.Get("Authorization"))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			writeError(w, http.StatusUnauthorized, "bad or missing token")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *Hub) handleAdminComponents(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	report, _ := h.healthReport()
+	writeJSON(w, http.StatusOK, report.Components)
+}
+
+func (h *Hub) handleAdminReactor(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	name, action, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/reactors/"), "/")
+	if !ok {
+		writeError(w, http.StatusNotFound, "no such endpoint")
+		return
+	}
+
+	status, ok := h.reactorStatus[ReactorName(name)]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no reactor named %q", name))
+		return
+	}
+
+	switch action {
+	case "enable":
+		status.setDisabled(false)
+	case "disable":
+		status.setDisabled(true)
+	default:
+		writeError(w, http.StatusNotFound, "no such endpoint")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, status.health())
+}
+
+func (h *Hub) handleAdminEvent(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req adminEventRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "bad json: "+err.Error())
+		return
+	}
+
+	bus, ok := h.buses[req.Bus]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no bus named %q", req.Bus))
+		return
+	}
+
+	// The hub would only drop it, so say so, as readiness does.
+	if h.draining.Load() {
+		writeError(w, http.StatusServiceUnavailable, ErrShuttingDown.Error())
+		return
+	}
+
+	event := NewEvent(bus)
+	event.Text = req.Text
+	event.Address = req.Address
+	event.Sender = req.Sender
+
+	select {
+	case h.events <- event:
+		writeJSON(w, http.StatusAccepted, map[string]uint64{"id": event.ID()})
+	case <-r.Context().Done():
+	case <-ctx.Done():
+		writeError(w, http.StatusServiceUnavailable, ErrShuttingDown.Error())
+	}
+}
+
+func (h *Hub) handleAdminReply(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req adminReplyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "bad json: "+err.Error())
+		return
+	}
+
+	if _, ok := h.buses[req.Bus]; !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no bus named %q", req.Bus))
+		return
+	}
+
+	reply := Reply{
+		Bus:     req.Bus,
+		Address: req.Address,
+		Text:    req.Text,
+	}
+
+	select {
+	case h.replies <- reply:
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "sent"})
+	case <-r.Context().Done():
+	case <-ctx.Done():
+		writeError(w, http.StatusServiceUnavailable, ErrShuttingDown.Error())
+	}
+}
+
+func requireMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	return false
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
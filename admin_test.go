@@ -0,0 +1,224 @@
+package marvin_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mmcclimon/marvin"
+	"github.com/mmcclimon/marvin/marvintest"
+	"github.com/mmcclimon/marvin/registry"
+)
+
+const adminToken = "sekrit"
+
+func startAdminHub(t *testing.T) (*marvintest.Hub, string) {
+	t.Helper()
+
+	addr := freeAddr(t)
+
+	hub := marvintest.StartHub(t, fmt.Sprintf(`
+		[bus.test]
+		type = "marvintest"
+
+		[reactor.echo]
+		type = "echo"
+
+		[admin]
+		listen = %q
+		token = %q
+	`, addr, adminToken), registry.Known())
+
+	return hub, "http://" + addr
+}
+
+func expectStatus(t *testing.T, method, url string, body any, want int) []byte {
+	t.Helper()
+
+	code, data := request(t, method, url, adminToken, body)
+	if code != want {
+		t.Fatalf("%s %s returned %d, wanted %d: %s", method, url, code, want, data)
+	}
+
+	return data
+}
+
+func TestAdminToken(t *testing.T) {
+	_, base := startAdminHub(t)
+
+	if code, _ := request(t, http.MethodGet, base+"/components", "", nil); code != http.StatusUnauthorized {
+		t.Errorf("got %d without a token, wanted 401", code)
+	}
+
+	if code, _ := request(t, http.MethodGet, base+"/components", "wrong", nil); code != http.StatusUnauthorized {
+		t.Errorf("got %d with the wrong token, wanted 401", code)
+	}
+
+	data := expectStatus(t, http.MethodGet, base+"/components", nil, http.StatusOK)
+
+	var components []marvin.ComponentHealth
+	if err := json.Unmarshal(data, &components); err != nil {
+		t.Fatalf("bad components list %s: %s", data, err)
+	}
+
+	if len(components) != 2 {
+		t.Errorf("got components %+v, wanted the bus and the reactor", components)
+	}
+}
+
+func TestAdminEnableDisable(t *testing.T) {
+	hub, base := startAdminHub(t)
+	bus := hub.Bus("test")
+
+	data := expectStatus(t, http.MethodPost, base+"/reactors/echo/disable", nil, http.StatusOK)
+
+	var status marvin.ComponentHealth
+	if err := json.Unmarshal(data, &status); err != nil || !status.Disabled {
+		t.Errorf("disabling echo returned %s", data)
+	}
+
+	// With echo off, nobody answers.
+	bus.Send("hello")
+	bus.ExpectReply("does not compute")
+
+	expectStatus(t, http.MethodPost, base+"/reactors/echo/enable", nil, http.StatusOK)
+
+	bus.Send("hello")
+	bus.ExpectReply("echo: >>> hello <<<")
+
+	expectStatus(t, http.MethodPost, base+"/reactors/nobody/disable", nil, http.StatusNotFound)
+	expectStatus(t, http.MethodPost, base+"/reactors/echo/explode", nil, http.StatusNotFound)
+	expectStatus(t, http.MethodGet, base+"/reactors/echo/disable", nil, http.StatusMethodNotAllowed)
+}
+
+func TestAdminInject(t *testing.T) {
+	hub, base := startAdminHub(t)
+	bus := hub.Bus("test")
+
+	expectStatus(t, http.MethodPost, base+"/events", map[string]any{
+		"bus":    "test",
+		"text":   "injected",
+		"sender": "admin",
+	}, http.StatusAccepted)
+
+	bus.ExpectReply("echo: >>> injected <<<")
+
+	expectStatus(t, http.MethodPost, base+"/replies", map[string]any{
+		"bus":     "test",
+		"address": "general",
+		"text":    "announcement",
+	}, http.StatusAccepted)
+
+	if reply := bus.ExpectReply("announcement"); reply.Address != "general" {
+		t.Errorf("reply went to %v, wanted general", reply.Address)
+	}
+
+	expectStatus(t, http.MethodPost, base+"/events", map[string]any{"bus": "nope", "text": "hi"}, http.StatusNotFound)
+	expectStatus(t, http.MethodPost, base+"/replies", map[string]any{"bus": "nope", "text": "hi"}, http.StatusNotFound)
+	expectStatus(t, http.MethodPost, base+"/events", "not an object", http.StatusBadRequest)
+}
+
+func TestAdminShutdown(t *testing.T) {
+	hub, base := startAdminHub(t)
+
+	expectStatus(t, http.MethodPost, base+"/shutdown", nil, http.StatusAccepted)
+
+	// Wait fails the test if the hub doesn't exit.
+	if err := hub.Wait(); err != nil {
+		t.Errorf("hub shut down with error: %s", err)
+	}
+}
+
+// lingerer is a reactor whose shutdown hook keeps the hub draining until
+// it's released.
+type lingerer struct {
+	draining chan struct{}
+	release  chan struct{}
+}
+
+func (l *lingerer) Run(ctx context.Context, comm marvin.ReactorBundle) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-comm.Events:
+		}
+	}
+}
+
+func (l *lingerer) OnShutdown(ctx context.Context) error {
+	close(l.draining)
+
+	select {
+	case <-l.release:
+	case <-ctx.Done():
+	}
+
+	return nil
+}
+
+func TestAdminInjectWhileDraining(t *testing.T) {
+	l := &lingerer{draining: make(chan struct{}), release: make(chan struct{})}
+
+	reg := registry.Known()
+	reg.RegisterReactor("lingerer", func(marvin.ReactorName, map[string]any) (marvin.Reactor, error) {
+		return l, nil
+	})
+
+	addr := freeAddr(t)
+	base := "http://" + addr
+
+	hub := marvintest.StartHub(t, fmt.Sprintf(`
+		[bus.test]
+		type = "marvintest"
+
+		[reactor.lingerer]
+		type = "lingerer"
+
+		[admin]
+		listen = %q
+		token = %q
+	`, addr, adminToken), reg)
+
+	expectStatus(t, http.MethodPost, base+"/shutdown", nil, http.StatusAccepted)
+
+	select {
+	case <-l.draining:
+	case <-time.After(marvintest.Timeout):
+		t.Fatal("hub never ran its shutdown hooks")
+	}
+
+	expectStatus(t, http.MethodPost, base+"/events", map[string]any{
+		"bus":  "test",
+		"text": "too late",
+	}, http.StatusServiceUnavailable)
+
+	close(l.release)
+
+	if err := hub.Wait(); err != nil {
+		t.Errorf("hub shut down with error: %s", err)
+	}
+}
+
+func TestAdminNeedsTokenOffLocalhost(t *testing.T) {
+	_, err := marvin.FromString(`
+		[admin]
+		listen = "0.0.0.0:9999"
+	`, registry.Known())
+
+	if err == nil {
+		t.Error("assembled a hub with an open admin API and no token")
+	}
+
+	_, err = marvin.FromString(`
+		[admin]
+		listen = "127.0.0.1:9999"
+	`, registry.Known())
+
+	if err != nil {
+		t.Errorf("couldn't assemble a hub with the admin API on localhost: %s", err)
+	}
+}
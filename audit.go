@@ -0,0 +1,218 @@
+package marvin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/mmcclimon/marvin/internal/rotate"
+)
+
+// AuditConfig configures the audit log, which records every event and reply
+// that passes through the hub as a line of JSON. Events that middleware drops
+// are recorded too, with the middleware's name as filtered_by, as are events
+// that are throttled, with the limit they went over as throttled.
+type AuditConfig struct {
+	// File is where to write the log; if it's empty, there's no audit log.
+	File       string
+	MaxSizeMB  int `toml:"max_size_mb"`
+	MaxBackups int `toml:"max_backups"`
+
+	// Events from (and replies to) these buses aren't recorded.
+	ExcludeBuses []string `toml:"exclude_buses"`
+
+	// Anything in event or reply text matching one of these regular
+	// expressions is replaced with "[REDACTED]".
+	Redact []string
+}
+
+type auditLog struct {
+	out     io.WriteCloser
+	exclude map[BusName]bool
+	redact  []*regexp.Regexp
+	records chan auditRecord
+}
+
+type auditRecord struct {
+	Time      time.Time   `json:"time"`
+	Kind      string      `json:"kind"`
+	EventID   uint64      `json:"event_id"`
+	Bus       BusName     `json:"bus"`
+	Address   any         `json:"address"`
+	Sender    string      `json:"sender,omitempty"`
+	Text      string      `json:"text"`
+	Reaction  string      `json:"reaction,omitempty"`
+	Reactor   ReactorName `json:"reactor,omitempty"`
+	LatencyMS *float64    `json:"latency_ms,omitempty"`
+	Watchdog  *bool       `json:"watchdog,omitempty"`
+
+	// for events that never reached the reactors
+	FilteredBy MiddlewareName `json:"filtered_by,omitempty"`
+	Throttled  string         `json:"throttled,omitempty"`
+}
+
+// If the writer falls this far behind, we start dropping records rather
+// than hold up the hub.
+const auditBuffer = 1024
+
+func newAuditLog(cfg AuditConfig) (*auditLog, error) {
+	if cfg.File == "" {
+		return nil, nil
+	}
+
+	maxSize := int64(cfg.MaxSizeMB) * 1024 * 1024
+	if maxSize == 0 {
+		maxSize = 100 * 1024 * 1024
+	}
+
+	a := &auditLog{
+		exclude: make(map[BusName]bool),
+		records: make(chan auditRecord, auditBuffer),
+	}
+
+	for _, bus := range cfg.ExcludeBuses {
+		a.exclude[BusName(bus)] = true
+	}
+
+	for _, pattern := range cfg.Redact {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("bad redaction pattern %q: %w", pattern, err)
+		}
+
+		a.redact = append(a.redact, re)
+	}
+
+	out, err := rotate.Open(cfg.File, maxSize, cfg.MaxBackups)
+	if err != nil {
+		return nil, fmt.Errorf("could not open audit log: %w", err)
+	}
+
+	a.out = out
+	return a, nil
+}
+
+// run writes records until ctx is cancelled. It's fine to call the record
+// methods on a nil auditLog (they do nothing), but not run.
+func (a *auditLog) run(ctx context.Context) {
+	defer a.out.Close()
+
+	enc := json.NewEncoder(a.out)
+	enc.SetEscapeHTML(false)
+
+	write := func(rec auditRecord) {
+		if err := enc.Encode(rec); err != nil {
+			slog.Warn("could not write audit record", "err", err)
+		}
+	}
+
+	for {
+		select {
+		case rec := <-a.records:
+			write(rec)
+
+		case <-ctx.Done():
+			// write out whatever's left, then go away
+			for {
+				select {
+				case rec := <-a.records:
+					write(rec)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (a *auditLog) recordEvent(event Event) {
+	if a == nil || a.exclude[event.SourceBus] {
+		return
+	}
+
+	a.send(a.eventRecord(event))
+}
+
+// recordFiltered records an event that middleware dropped, so that any reply
+// the middleware sent instead isn't a reply to nothing.
+func (a *auditLog) recordFiltered(event Event, by MiddlewareName) {
+	if a == nil || a.exclude[event.SourceBus] {
+		return
+	}
+
+	rec := a.eventRecord(event)
+	rec.FilteredBy = by
+	a.send(rec)
+}
+
+// recordThrottled records an event that went over the named rate limit.
+func (a *auditLog) recordThrottled(event Event, scope string) {
+	if a == nil || a.exclude[event.SourceBus] {
+		return
+	}
+
+	rec := a.eventRecord(event)
+	rec.Throttled = scope
+	a.send(rec)
+}
+
+func (a *auditLog) eventRecord(event Event) auditRecord {
+	return auditRecord{
+		Time:     event.received,
+		Kind:     "event",
+		EventID:  event.id,
+		Bus:      event.SourceBus,
+		Address:  event.Address,
+		Sender:   event.Sender,
+		Text:     a.redacted(event.Text),
+		Reaction: event.Reaction,
+	}
+}
+
+func (a *auditLog) recordReply(reply Reply) {
+	if a == nil || a.exclude[reply.Bus] {
+		return
+	}
+
+	now := time.Now()
+	watchdog := reply.watchdog
+
+	rec := auditRecord{
+		Time:     now,
+		Kind:     "reply",
+		EventID:  reply.EventID,
+		Bus:      reply.Bus,
+		Address:  reply.Address,
+		Text:     a.redacted(reply.Text),
+		Reaction: reply.Reaction,
+		Reactor:  reply.Reactor,
+		Watchdog: &watchdog,
+	}
+
+	if !reply.received.IsZero() {
+		latency := float64(now.Sub(reply.received)) / float64(time.Millisecond)
+		rec.LatencyMS = &latency
+	}
+
+	a.send(rec)
+}
+
+func (a *auditLog) send(rec auditRecord) {
+	select {
+	case a.records <- rec:
+	default:
+		slog.Warn("audit log is backed up; dropping record", "event_id", rec.EventID)
+	}
+}
+
+func (a *auditLog) redacted(text string) string {
+	for _, re := range a.redact {
+		text = re.ReplaceAllString(text, "[REDACTED]")
+	}
+
+	return text
+}
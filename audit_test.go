@@ -0,0 +1,219 @@
+package marvin_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mmcclimon/marvin"
+	"github.com/mmcclimon/marvin/marvintest"
+	"github.com/mmcclimon/marvin/registry"
+)
+
+type auditRecord struct {
+	Kind    string `json:"kind"`
+	EventID uint64 `json:"event_id"`
+	Bus     string `json:"bus"`
+	Sender  string `json:"sender"`
+	Text    string `json:"text"`
+	Reactor string `json:"reactor"`
+
+	FilteredBy string `json:"filtered_by"`
+	Throttled  string `json:"throttled"`
+}
+
+func readAudit(t *testing.T, path string) []auditRecord {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("could not open audit log: %s", err)
+	}
+
+	defer f.Close()
+
+	var records []auditRecord
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("bad audit line %q: %s", scanner.Text(), err)
+		}
+
+		records = append(records, rec)
+	}
+
+	return records
+}
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	hub := marvintest.StartHub(t, fmt.Sprintf(`
+		[bus.test]
+		type = "marvintest"
+
+		[bus.secret]
+		type = "marvintest"
+
+		[reactor.echo]
+		type = "echo"
+
+		[audit]
+		file = %q
+		exclude_buses = ["secret"]
+		redact = ['\d{4}-\d{4}']
+	`, path), registry.Known())
+
+	test, secret := hub.Bus("test"), hub.Bus("secret")
+
+	test.Send("my card is 1234-5678", marvintest.WithSender("arthur"))
+	test.ExpectReply("echo: >>> my card is 1234-5678 <<<")
+
+	secret.Send("the answer is 42")
+	secret.ExpectReply("echo: >>> the answer is 42 <<<")
+
+	// The log's only sure to be written out once the hub's stopped.
+	if err := hub.Stop(); err != nil {
+		t.Fatalf("hub stopped with error: %s", err)
+	}
+
+	records := readAudit(t, path)
+	if len(records) != 2 {
+		t.Fatalf("got %d audit records, wanted 2: %+v", len(records), records)
+	}
+
+	event, reply := records[0], records[1]
+
+	if event.Kind != "event" || event.Bus != "test" || event.Sender != "arthur" || event.Text != "my card is [REDACTED]" {
+		t.Errorf("got unexpected event record %+v", event)
+	}
+
+	if reply.Kind != "reply" || reply.Reactor != "echo" || reply.Text != "echo: >>> my card is [REDACTED] <<<" {
+		t.Errorf("got unexpected reply record %+v", reply)
+	}
+
+	if reply.EventID != event.EventID {
+		t.Errorf("reply has event id %d, wanted %d", reply.EventID, event.EventID)
+	}
+
+	for _, rec := range records {
+		if rec.Bus == "secret" || strings.Contains(rec.Text, "42") {
+			t.Errorf("recorded something from an excluded bus: %+v", rec)
+		}
+	}
+}
+
+// Events that never reach the reactors are still recorded, so that whatever
+// was sent back instead is a reply to something.
+func TestAuditFiltered(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	hub := marvintest.StartHub(t, fmt.Sprintf(`
+		[bus.test]
+		type = "marvintest"
+
+		[reactor.echo]
+		type = "echo"
+
+		[[middleware]]
+		name = "no-belgium"
+		type = "wordfilter"
+		words = ["belgium"]
+		action = "reply"
+		reply = "nope"
+
+		[audit]
+		file = %q
+	`, path), registry.Known())
+
+	bus := hub.Bus("test")
+	bus.Send("oh, belgium")
+	bus.ExpectReply("nope")
+
+	if err := hub.Stop(); err != nil {
+		t.Fatalf("hub stopped with error: %s", err)
+	}
+
+	records := readAudit(t, path)
+	if len(records) != 2 {
+		t.Fatalf("got %d audit records, wanted 2: %+v", len(records), records)
+	}
+
+	event, reply := records[0], records[1]
+
+	if event.Kind != "event" || event.Text != "oh, belgium" || event.FilteredBy != "no-belgium" {
+		t.Errorf("got unexpected event record %+v", event)
+	}
+
+	if reply.Kind != "reply" || reply.Text != "nope" || reply.EventID != event.EventID {
+		t.Errorf("got unexpected reply record %+v", reply)
+	}
+}
+
+func TestAuditThrottled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	hub := marvintest.StartHub(t, fmt.Sprintf(`
+		[bus.test]
+		type = "marvintest"
+
+		[reactor.echo]
+		type = "echo"
+
+		[ratelimit]
+		per_sender = { every = "1h", burst = 1 }
+		notice = "slow down"
+
+		[audit]
+		file = %q
+	`, path), registry.Known())
+
+	bus := hub.Bus("test")
+
+	bus.Send("one", marvintest.WithSender("arthur"))
+	bus.ExpectReply("echo: >>> one <<<")
+
+	bus.Send("two", marvintest.WithSender("arthur"))
+	bus.ExpectReply("slow down")
+
+	if err := hub.Stop(); err != nil {
+		t.Fatalf("hub stopped with error: %s", err)
+	}
+
+	records := readAudit(t, path)
+	if len(records) != 4 {
+		t.Fatalf("got %d audit records, wanted 4: %+v", len(records), records)
+	}
+
+	event, notice := records[2], records[3]
+
+	if event.Kind != "event" || event.Text != "two" || event.Throttled != "sender" {
+		t.Errorf("got unexpected event record %+v", event)
+	}
+
+	if notice.Kind != "reply" || notice.Text != "slow down" || notice.EventID != event.EventID {
+		t.Errorf("got unexpected reply record %+v", notice)
+	}
+
+	if records[0].Throttled != "" {
+		t.Errorf("allowed event was recorded as throttled: %+v", records[0])
+	}
+}
+
+func TestAuditBadRedaction(t *testing.T) {
+	_, err := marvin.FromString(fmt.Sprintf(`
+		[audit]
+		file = %q
+		redact = ['(unclosed']
+	`, filepath.Join(t.TempDir(), "audit.log")), registry.Known())
+
+	if err == nil {
+		t.Error("assembled a hub with a bad redaction pattern")
+	}
+}
@@ -18,12 +18,36 @@ type Bus interface {
 	SendMessage(ctx context.Context, address any, text string)
 }
 
+// ReactionBus is a bus that can react to messages. Replies with a Reaction
+// are passed to buses that aren't ReactionBuses as text.
+type ReactionBus interface {
+	Bus
+	React(ctx context.Context, address any, messageID, emoji string)
+}
+
+// EditBus is a bus that can edit and delete the messages it sends, which
+// replies refer to by Ref.
+type EditBus interface {
+	Bus
+	EditMessage(ctx context.Context, ref, text string) error
+	DeleteMessage(ctx context.Context, ref string) error
+}
+
 func (h *Hub) wrapBusFunc(
 	ctx context.Context,
 	base func(context.Context, BusBundle) error,
 	bundle BusBundle,
+	status *componentStatus,
 ) func() error {
 	return func() error {
-		return base(ctx, bundle)
+		status.setRunning(true)
+		defer status.exited()
+
+		err := base(ctx, bundle)
+		if err != nil {
+			status.recordError(err)
+		}
+
+		return err
 	}
 }
@@ -4,10 +4,13 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/mitchellh/mapstructure"
 	"github.com/mmcclimon/marvin"
 	"github.com/mmcclimon/marvin/buses/discord/internal/discord"
+	"github.com/mmcclimon/marvin/trace"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type Discord struct {
@@ -15,35 +18,183 @@ type Discord struct {
 	discord *discord.Client
 	logger  *slog.Logger
 	raw     chan []byte
+	metrics []prometheus.Collector
+	goodbye goodbye
+
+	replyStyle string
+	attachOver int
+	typing     typing
+	refs       sentRefs
+	filter     filter
 }
 
 type config struct {
-	Token string `mapstructure:"api_token"`
+	Token   string  `mapstructure:"api_token"`
+	Goodbye goodbye `mapstructure:"goodbye"`
+
+	// Compress turns on zlib-stream compression for the gateway.
+	Compress bool `mapstructure:"compress"`
+
+	// Shards is how many gateway connections to run; if it's zero, we run
+	// as many as Discord recommends.
+	Shards int `mapstructure:"shards"`
+
+	Presence presence `mapstructure:"presence"`
+	Typing   typing   `mapstructure:"typing"`
+
+	// Intents are the gateway intents to ask for, by name, like
+	// "guild_messages"; if there are none, we ask for discord.DefaultIntents.
+	Intents []string `mapstructure:"intents"`
+
+	filter `mapstructure:",squash"`
+
+	// ReplyStyle is how replies to messages go out: "message" (the
+	// default), "reference", or "thread".
+	ReplyStyle string `mapstructure:"reply_style"`
+
+	// Messages too long for Discord are split up, but if AttachOver is set,
+	// ones longer than that many characters are uploaded as a text file
+	// instead.
+	AttachOver int `mapstructure:"attach_over"`
+
+	// These are for pointing the bus at something other than the real
+	// Discord, like a fake one in tests.
+	APIURL     string `mapstructure:"api_url"`
+	GatewayURL string `mapstructure:"gateway_url"`
+}
+
+// presence is what the bot shows when it connects, like "Watching for
+// deploys".
+type presence struct {
+	Status   string `mapstructure:"status"`
+	Activity string `mapstructure:"activity"`
+	Text     string `mapstructure:"text"`
+}
+
+// goodbye is a message to post on shutdown, if both fields are set.
+type goodbye struct {
+	ChannelID string `mapstructure:"channel_id"`
+	Text      string `mapstructure:"text"`
 }
 
 func Assemble(name marvin.BusName, rawConfig map[string]any) (marvin.Bus, error) {
-	var cfg config
-	if err := mapstructure.Decode(rawConfig, &cfg); err != nil {
+	cfg := config{
+		Typing: typing{After: time.Second, Limit: time.Minute},
+	}
+
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.StringToTimeDurationHookFunc(),
+		Result:     &cfg,
+	})
+	if err != nil {
 		return nil, fmt.Errorf("bad config for %s bus: %w", name, err)
 	}
 
+	if err := decoder.Decode(rawConfig); err != nil {
+		return nil, fmt.Errorf("bad config for %s bus: %w", name, err)
+	}
+
+	initial, err := discord.NewPresence(cfg.Presence.Status, cfg.Presence.Activity, cfg.Presence.Text)
+	if err != nil {
+		return nil, fmt.Errorf("bad config for %s bus: presence: %w", name, err)
+	}
+
+	if cfg.ReplyStyle == "" {
+		cfg.ReplyStyle = styleMessage
+	}
+
+	if !validReplyStyle(cfg.ReplyStyle) {
+		return nil, fmt.Errorf("bad config for %s bus: unknown reply_style %q", name, cfg.ReplyStyle)
+	}
+
+	if cfg.AttachOver < 0 {
+		return nil, fmt.Errorf("bad config for %s bus: attach_over can't be negative", name)
+	}
+
+	if cfg.Typing.After > 0 && cfg.Typing.Limit <= cfg.Typing.After {
+		return nil, fmt.Errorf("bad config for %s bus: typing limit has to be longer than typing after", name)
+	}
+
+	intents := discord.DefaultIntents
+	if len(cfg.Intents) > 0 {
+		intents, err = discord.ParseIntents(cfg.Intents)
+		if err != nil {
+			return nil, fmt.Errorf("bad config for %s bus: %w", name, err)
+		}
+	}
+
 	logger := slog.Default().With("bus", name)
 
-	return &Discord{
-		name:    name,
-		raw:     make(chan []byte),
-		discord: discord.NewClient(logger, cfg.Token),
-		logger:  logger,
-	}, nil
+	d := &Discord{
+		name:       name,
+		raw:        make(chan []byte),
+		discord:    discord.NewClient(logger, cfg.Token),
+		logger:     logger,
+		goodbye:    cfg.Goodbye,
+		replyStyle: cfg.ReplyStyle,
+		attachOver: cfg.AttachOver,
+		typing:     cfg.Typing,
+		filter:     cfg.filter,
+	}
+
+	if cfg.APIURL != "" {
+		d.discord.SetAPIBase(cfg.APIURL)
+	}
+
+	if cfg.GatewayURL != "" {
+		d.discord.SetGatewayURL(cfg.GatewayURL)
+	}
+
+	d.discord.SetCompression(cfg.Compress)
+	d.discord.SetShards(cfg.Shards)
+	d.discord.SetIntents(intents)
+	d.discord.SetPresence(initial)
+
+	d.setUpMetrics()
+
+	return d, nil
+}
+
+func (d *Discord) setUpMetrics() {
+	labels := prometheus.Labels{"bus": string(d.name)}
+
+	latency := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:        "marvin_discord_heartbeat_ack_latency_seconds",
+		Help:        "Time between sending a gateway heartbeat and getting it acked.",
+		ConstLabels: labels,
+		Buckets:     prometheus.ExponentialBuckets(0.01, 2, 10),
+	})
+
+	reconnects := prometheus.NewCounter(prometheus.CounterOpts{
+		Name:        "marvin_discord_reconnects_total",
+		Help:        "Gateway connections started over from scratch.",
+		ConstLabels: labels,
+	})
+
+	resumes := prometheus.NewCounter(prometheus.CounterOpts{
+		Name:        "marvin_discord_resumes_total",
+		Help:        "Gateway sessions resumed after a disconnect.",
+		ConstLabels: labels,
+	})
+
+	d.discord.SetMetrics(discord.Metrics{
+		HeartbeatLatency: latency,
+		Reconnects:       reconnects,
+		Resumes:          resumes,
+	})
+
+	d.metrics = []prometheus.Collector{latency, reconnects, resumes}
 }
 
+func (d *Discord) Collectors() []prometheus.Collector { return d.metrics }
+
 func (d *Discord) Run(ctx context.Context, comm marvin.BusBundle) error {
 	if err := d.discord.Connect(ctx); err != nil {
 		return err
 	}
 
-	msgCh := make(chan discord.Message)
-	go d.discord.Run(ctx, msgCh, comm.Errors)
+	incoming := make(chan discord.Incoming)
+	go d.discord.Run(ctx, incoming, comm.Errors)
 
 	for {
 		select {
@@ -56,40 +207,137 @@ func (d *Discord) Run(ctx context.Context, comm marvin.BusBundle) error {
 			d.logger.Warn("fatal err from discord", "err", err)
 			return err
 
-		case err := <-d.discord.Errors():
-			d.logger.Warn("caught error from discord client", "err", err)
-
 		case reply := <-comm.Replies:
-			d.SendMessage(ctx, reply.Address, reply.Text)
+			d.handleReply(reply.TraceContext(ctx), reply)
 
-		case msg := <-msgCh:
-			if msg.Author.IsBot {
+		case in := <-incoming:
+			evt, ok := d.eventFrom(in)
+			if !ok {
 				continue
 			}
 
-			evt := d.eventFromMessage(msg)
 			comm.Events <- evt
+
+			if evt.Kind == marvin.KindMessage {
+				go d.showTyping(ctx, evt)
+			}
 		}
 	}
 }
 
+// eventFrom makes an event out of something from the gateway, unless it's
+// from a bot or somewhere we've been told to ignore.
+func (d *Discord) eventFrom(in discord.Incoming) (marvin.Event, bool) {
+	if guildID, channelID := origin(in); !d.filter.allows(guildID, channelID) {
+		d.logger.Debug("ignoring event", "guild_id", guildID, "channel_id", channelID)
+		return marvin.Event{}, false
+	}
+
+	switch in := in.(type) {
+	case *discord.Message:
+		if in.Author.IsBot {
+			return marvin.Event{}, false
+		}
+
+		return d.eventFromMessage(*in), true
+
+	case *discord.MessageEdit:
+		if in.Author.IsBot {
+			return marvin.Event{}, false
+		}
+
+		ev := d.eventFromMessage(in.Message)
+		ev.Kind = marvin.KindEdit
+		return ev, true
+
+	case *discord.MessageDelete:
+		ev := marvin.NewEvent(d)
+		ev.Kind = marvin.KindDelete
+		ev.Address = in.ChannelID
+		ev.MessageID = in.ID
+		ev.Direct = in.GuildID == ""
+		return ev, true
+
+	case *discord.Reaction:
+		if in.Member.User != nil && in.Member.User.IsBot {
+			return marvin.Event{}, false
+		}
+
+		return d.eventFromReaction(*in), true
+	}
+
+	return marvin.Event{}, false
+}
+
 func (d *Discord) eventFromMessage(msg discord.Message) marvin.Event {
 	ev := marvin.NewEvent(d)
 	ev.Text = d.discord.DecodeFormatting(msg)
 	ev.Address = msg.ChannelID
+	ev.Sender = msg.Author.Username
+	ev.Roles = msg.Member.Roles
+	ev.Direct = msg.GuildID == ""
+	ev.MessageID = msg.ID
+	return ev
+}
+
+func (d *Discord) eventFromReaction(r discord.Reaction) marvin.Event {
+	ev := marvin.NewEvent(d)
+	ev.Kind = marvin.KindReaction
+	ev.Reaction = r.Emoji.String()
+	ev.MessageID = r.MessageID
+	ev.Address = r.ChannelID
+	ev.Roles = r.Member.Roles
+	ev.Direct = r.GuildID == ""
+
+	// Direct message reactions only come with an id.
+	ev.Sender = r.UserID
+	if r.Member.User != nil {
+		ev.Sender = r.Member.User.Username
+	}
+
 	return ev
 }
 
 func (d *Discord) Name() marvin.BusName { return d.name }
 
+func (d *Discord) Healthy() error { return d.discord.Healthy() }
+
 func (d *Discord) SendMessage(ctx context.Context, address any, text string) {
-	url := discord.URLFor("/channels/%s/messages", address)
-	res, err := d.discord.Post(ctx, url, map[string]string{"content": text})
+	d.post(ctx, fmt.Sprint(address), discord.OutgoingMessage{Content: text})
+}
 
+// React adds a reaction to a message.
+func (d *Discord) React(ctx context.Context, address any, messageID, emoji string) {
+	ctx, span := trace.Start(ctx, "discord.react",
+		trace.String("channel_id", fmt.Sprint(address)),
+		trace.String("message_id", messageID),
+	)
+	defer span.End()
+
+	err := d.discord.React(ctx, fmt.Sprint(address), messageID, emoji)
+	if err != nil {
+		span.RecordError(err)
+		d.logger.Warn("bad reaction", "err", err)
+	}
+}
+
+// SetPresence updates the bot's presence on every shard.
+func (d *Discord) SetPresence(_ context.Context, p marvin.Presence) error {
+	presence, err := discord.NewPresence(p.Status, p.Activity, p.Text)
 	if err != nil {
-		d.logger.Warn("bad message post", "err", err)
-		return
+		return err
+	}
+
+	d.discord.SetPresence(presence)
+	return nil
+}
+
+// OnShutdown posts the configured goodbye message, if there is one.
+func (d *Discord) OnShutdown(ctx context.Context) error {
+	if d.goodbye.ChannelID == "" || d.goodbye.Text == "" {
+		return nil
 	}
 
-	d.discord.CheckAPIResponse(res)
+	d.SendMessage(ctx, d.goodbye.ChannelID, d.goodbye.Text)
+	return nil
 }
@@ -0,0 +1,408 @@
+package discord_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcclimon/marvin"
+	"github.com/mmcclimon/marvin/buses/discord"
+	"github.com/mmcclimon/marvin/buses/discord/internal/fakediscord"
+	"github.com/mmcclimon/marvin/marvintest"
+	"github.com/mmcclimon/marvin/registry"
+)
+
+func TestEchoThroughDiscord(t *testing.T) {
+	srv := fakediscord.NewServer(t)
+
+	marvintest.StartHub(t, fmt.Sprintf(`
+		[bus.discord]
+		type = "discord"
+		api_token = "test-token"
+		api_url = %q
+
+		[reactor.echo]
+		type = "echo"
+	`, srv.APIBase), registry.Known())
+
+	conn := srv.NextConn()
+	conn.SendHello(time.Second)
+	conn.Expect(fakediscord.OpIdentify)
+	conn.SendReady("session-1")
+
+	conn.SendMessageCreate("123", "arthur", "hello")
+
+	msg := srv.ExpectPost()
+
+	if msg.ChannelID != "123" || msg.Body["content"] != "echo: >>> hello <<<" {
+		t.Errorf("got unexpected post %+v", msg)
+	}
+
+	if msg.Authorization != "Bot test-token" {
+		t.Errorf("posted with authorization %q", msg.Authorization)
+	}
+}
+
+// acker reacts to messages with a checkmark, and says who reacted to what.
+type acker struct{}
+
+func (acker) Run(ctx context.Context, comm marvin.ReactorBundle) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event := <-comm.Events:
+			event.MarkHandled()
+
+			if event.Kind == marvin.KindReaction {
+				comm.Replies <- event.Reply("%s reacted %s to %s", event.Sender, event.Reaction, event.MessageID)
+				continue
+			}
+
+			comm.Replies <- event.React("✅")
+		}
+	}
+}
+
+func TestReactions(t *testing.T) {
+	srv := fakediscord.NewServer(t)
+
+	reg := registry.New()
+	reg.RegisterReactor("acker", func(marvin.ReactorName, map[string]any) (marvin.Reactor, error) {
+		return acker{}, nil
+	})
+
+	marvintest.StartHub(t, fmt.Sprintf(`
+		[bus.discord]
+		type = "discord"
+		api_token = "test-token"
+		api_url = %q
+
+		[reactor.acker]
+		type = "acker"
+		events = ["message", "reaction"]
+	`, srv.APIBase), registry.Compose(registry.Known(), reg))
+
+	conn := srv.NextConn()
+	conn.SendHello(time.Second)
+	conn.Expect(fakediscord.OpIdentify)
+	conn.SendReady("session-1")
+
+	conn.SendMessageCreate("123", "arthur", "deploy, please")
+
+	got := srv.ExpectReaction()
+	if want := (fakediscord.PostedReaction{ChannelID: "123", MessageID: "100", Emoji: "✅"}); got != want {
+		t.Errorf("got reaction %+v, wanted %+v", got, want)
+	}
+
+	conn.SendReactionAdd("123", "100", "2", "arthur", "🎉")
+
+	msg := srv.ExpectPost()
+	if msg.Body["content"] != "arthur reacted 🎉 to 100" {
+		t.Errorf("got unexpected post %+v", msg)
+	}
+}
+
+// replyFunc is a reactor that replies to every event with whatever reply
+// returns, if it returns anything.
+type replyFunc func(marvin.Event) []marvin.Reply
+
+func (f replyFunc) Run(ctx context.Context, comm marvin.ReactorBundle) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event := <-comm.Events:
+			event.MarkHandled()
+
+			for _, reply := range f(event) {
+				comm.Replies <- reply
+			}
+		}
+	}
+}
+
+// startWithReactor starts a hub with a Discord bus connected to srv, with
+// the extra bus config given, and one reactor that replies with f.
+func startWithReactor(t *testing.T, srv *fakediscord.Server, busConfig, reactorConfig string, f replyFunc) *fakediscord.Conn {
+	t.Helper()
+
+	reg := registry.New()
+	reg.RegisterReactor("func", func(marvin.ReactorName, map[string]any) (marvin.Reactor, error) {
+		return f, nil
+	})
+
+	marvintest.StartHub(t, fmt.Sprintf(`
+		[bus.discord]
+		type = "discord"
+		api_token = "test-token"
+		api_url = %q
+		%s
+
+		[reactor.func]
+		type = "func"
+		%s
+	`, srv.APIBase, busConfig, reactorConfig), registry.Compose(registry.Known(), reg))
+
+	conn := srv.NextConn()
+	conn.SendHello(time.Second)
+	conn.Expect(fakediscord.OpIdentify)
+	conn.SendReady("session-1")
+
+	return conn
+}
+
+func TestReplyStyles(t *testing.T) {
+	say := func(event marvin.Event) []marvin.Reply {
+		return []marvin.Reply{event.Reply("one"), event.Reply("two")}
+	}
+
+	t.Run("reference", func(t *testing.T) {
+		srv := fakediscord.NewServer(t)
+		conn := startWithReactor(t, srv, `reply_style = "reference"`, "", say)
+
+		conn.SendMessageCreate("123", "arthur", "hello")
+
+		msg := srv.ExpectPost()
+		ref, _ := msg.Body["message_reference"].(map[string]any)
+
+		if msg.ChannelID != "123" || ref["message_id"] != "100" {
+			t.Errorf("got unexpected post %+v", msg)
+		}
+	})
+
+	t.Run("thread", func(t *testing.T) {
+		srv := fakediscord.NewServer(t)
+		conn := startWithReactor(t, srv, `reply_style = "thread"`, "", say)
+
+		conn.SendMessageCreate("123", "arthur", "hello")
+
+		thread := srv.ExpectCall()
+		if thread.ChannelID != "123" || thread.MessageID != "100" || thread.Body["name"] != "one" {
+			t.Errorf("got unexpected thread %+v", thread)
+		}
+
+		// Both replies go in the thread, even though the second one finds
+		// it already started.
+		for _, want := range []string{"one", "two"} {
+			msg := srv.ExpectPost()
+			if msg.ChannelID != "100" || msg.Body["content"] != want {
+				t.Errorf("got unexpected post %+v", msg)
+			}
+		}
+	})
+
+	t.Run("named thread", func(t *testing.T) {
+		srv := fakediscord.NewServer(t)
+		conn := startWithReactor(t, srv, "", "", func(event marvin.Event) []marvin.Reply {
+			reply := event.Reply("let's talk")
+			reply.Thread = "deploy chat"
+			return []marvin.Reply{reply}
+		})
+
+		conn.SendMessageCreate("123", "arthur", "hello")
+
+		if thread := srv.ExpectCall(); thread.Body["name"] != "deploy chat" {
+			t.Errorf("got unexpected thread %+v", thread)
+		}
+
+		if msg := srv.ExpectPost(); msg.ChannelID != "100" {
+			t.Errorf("got post in %s, wanted it in the thread", msg.ChannelID)
+		}
+	})
+}
+
+func TestEditAndDeleteByRef(t *testing.T) {
+	srv := fakediscord.NewServer(t)
+	conn := startWithReactor(t, srv, "", "", func(event marvin.Event) []marvin.Reply {
+		reply := event.Reply("deploy: %s", event.Text)
+		reply.Ref = "deploy-123"
+		reply.Delete = event.Text == "forget it"
+		return []marvin.Reply{reply}
+	})
+
+	conn.SendMessageCreate("123", "arthur", "starting")
+	posted := srv.ExpectPost()
+
+	conn.SendMessageCreate("123", "arthur", "done")
+
+	edit := srv.ExpectCall()
+	if edit.Method != "PATCH" || edit.ChannelID != posted.ChannelID || edit.MessageID != "1" || edit.Body["content"] != "deploy: done" {
+		t.Errorf("got unexpected edit %+v", edit)
+	}
+
+	conn.SendMessageCreate("123", "arthur", "forget it")
+
+	if del := srv.ExpectCall(); del.Method != "DELETE" || del.MessageID != "1" {
+		t.Errorf("got unexpected delete %+v", del)
+	}
+
+	// Once it's gone, the ref starts over with a new message.
+	conn.SendMessageCreate("123", "arthur", "again")
+
+	if msg := srv.ExpectPost(); msg.Body["content"] != "deploy: again" {
+		t.Errorf("got unexpected post %+v", msg)
+	}
+}
+
+func TestEditAndDeleteEvents(t *testing.T) {
+	srv := fakediscord.NewServer(t)
+	conn := startWithReactor(t, srv, "", `events = ["edit", "delete"]`, func(event marvin.Event) []marvin.Reply {
+		return []marvin.Reply{event.Reply("%s %s: %q", event.Kind, event.MessageID, event.Text)}
+	})
+
+	expectPost := func(want string) {
+		t.Helper()
+
+		if msg := srv.ExpectPost(); msg.Body["content"] != want {
+			t.Errorf("got post %q, wanted %q", msg.Body["content"], want)
+		}
+	}
+
+	conn.SendMessageUpdate("123", "100", "arthur", "deploy prod")
+	expectPost(`edit 100: "deploy prod"`)
+
+	conn.SendMessageDelete("123", "100")
+	expectPost(`delete 100: ""`)
+}
+
+func TestGuildAndChannelFilters(t *testing.T) {
+	say := func(event marvin.Event) []marvin.Reply {
+		return []marvin.Reply{event.Reply("%s", event.Text)}
+	}
+
+	srv := fakediscord.NewServer(t)
+	conn := startWithReactor(t, srv, `
+		guilds = ["10"]
+		exclude_channels = ["666"]
+	`, "", say)
+
+	conn.SendMessageCreate("666", "arthur", "excluded channel")
+	conn.Dispatch("MESSAGE_CREATE", map[string]any{
+		"id":         "101",
+		"channel_id": "123",
+		"guild_id":   "11",
+		"content":    "other guild",
+		"author":     map[string]any{"id": "2", "username": "arthur"},
+	})
+	conn.SendMessageCreate("123", "arthur", "allowed")
+
+	msg := srv.ExpectPost()
+	if msg.ChannelID != "123" || msg.Body["content"] != "allowed" {
+		t.Errorf("got unexpected post %+v", msg)
+	}
+
+	// Guild lists don't apply to direct messages.
+	conn.Dispatch("MESSAGE_CREATE", map[string]any{
+		"id":         "102",
+		"channel_id": "200",
+		"content":    "direct",
+		"author":     map[string]any{"id": "2", "username": "arthur"},
+	})
+
+	msg = srv.ExpectPost()
+	if msg.ChannelID != "200" || msg.Body["content"] != "direct" {
+		t.Errorf("got unexpected post %+v", msg)
+	}
+}
+
+func TestBadIntents(t *testing.T) {
+	_, err := discord.Assemble("discord", map[string]any{
+		"api_token": "test-token",
+		"intents":   []string{"guild_messages", "telepathy"},
+	})
+
+	if err == nil || !strings.Contains(err.Error(), "telepathy") {
+		t.Errorf("assembled with a made-up intent; err = %v", err)
+	}
+}
+
+func TestLongReplies(t *testing.T) {
+	long := strings.Repeat("don't panic\n", 500)
+	say := func(event marvin.Event) []marvin.Reply {
+		return []marvin.Reply{event.Reply("%s", long)}
+	}
+
+	t.Run("split", func(t *testing.T) {
+		srv := fakediscord.NewServer(t)
+		conn := startWithReactor(t, srv, `reply_style = "reference"`, "", say)
+
+		conn.SendMessageCreate("123", "arthur", "hello")
+
+		var got []string
+		for len(strings.Join(got, "\n")) < len(long)-1 {
+			msg := srv.ExpectPost()
+			ref, _ := msg.Body["message_reference"].(map[string]any)
+
+			if len(got) == 0 && ref["message_id"] != "100" {
+				t.Errorf("first part doesn't reply to the message: %+v", msg.Body)
+			}
+
+			if len(got) > 0 && ref != nil {
+				t.Errorf("part %d replies to the message too", len(got))
+			}
+
+			got = append(got, msg.Body["content"].(string))
+		}
+
+		if joined := strings.Join(got, "\n"); joined != strings.TrimSuffix(long, "\n") {
+			t.Errorf("parts don't add up to the reply")
+		}
+	})
+
+	t.Run("attach", func(t *testing.T) {
+		srv := fakediscord.NewServer(t)
+		conn := startWithReactor(t, srv, `attach_over = 4000`, "", say)
+
+		conn.SendMessageCreate("123", "arthur", "hello")
+
+		msg := srv.ExpectPost()
+		if msg.Files["message.txt"] != long {
+			t.Errorf("didn't upload the reply as a file: %+v", msg)
+		}
+
+		if msg.Body["content"] != "" {
+			t.Errorf("uploaded with content %q", msg.Body["content"])
+		}
+	})
+}
+
+func TestTypingIndicator(t *testing.T) {
+	slow := func(event marvin.Event) []marvin.Reply {
+		time.Sleep(200 * time.Millisecond)
+		return []marvin.Reply{event.Reply("sorry, I was thinking")}
+	}
+
+	srv := fakediscord.NewServer(t)
+	conn := startWithReactor(t, srv, `
+		[bus.discord.typing]
+		after = "20ms"
+	`, "", slow)
+
+	conn.SendMessageCreate("123", "arthur", "what's the answer?")
+
+	call := srv.ExpectCall()
+	if call.Method != "POST" || call.ChannelID != "123" {
+		t.Errorf("got unexpected api call %+v", call)
+	}
+
+	msg := srv.ExpectPost()
+	if msg.Body["content"] != "sorry, I was thinking" {
+		t.Errorf("got unexpected post %+v", msg)
+	}
+}
+
+func TestBadTypingConfig(t *testing.T) {
+	_, err := discord.Assemble("discord", map[string]any{
+		"api_token": "test-token",
+		"typing":    map[string]any{"after": "5s", "limit": "2s"},
+	})
+
+	if err == nil {
+		t.Error("assembled with a typing limit shorter than its delay")
+	}
+}
@@ -0,0 +1,59 @@
+package discord
+
+import (
+	"slices"
+
+	"github.com/mmcclimon/marvin/buses/discord/internal/discord"
+)
+
+// filter limits which guilds and channels the bus pays attention to at all;
+// anything else is dropped before it becomes an event. It lives at the top
+// level of the bus's config:
+//
+//	[bus.discord]
+//	type = "discord"
+//	guilds = ["1234567890"]
+//	exclude_channels = ["2345678901"]
+//
+// Direct messages aren't in a guild, so the guild lists don't affect them.
+// Threads are channels of their own, and aren't let through by their parent.
+type filter struct {
+	Guilds          []string `mapstructure:"guilds"`
+	ExcludeGuilds   []string `mapstructure:"exclude_guilds"`
+	Channels        []string `mapstructure:"channels"`
+	ExcludeChannels []string `mapstructure:"exclude_channels"`
+}
+
+func (f filter) allows(guildID, channelID string) bool {
+	if guildID != "" {
+		if len(f.Guilds) > 0 && !slices.Contains(f.Guilds, guildID) {
+			return false
+		}
+
+		if slices.Contains(f.ExcludeGuilds, guildID) {
+			return false
+		}
+	}
+
+	if len(f.Channels) > 0 && !slices.Contains(f.Channels, channelID) {
+		return false
+	}
+
+	return !slices.Contains(f.ExcludeChannels, channelID)
+}
+
+// origin says where something from the gateway happened.
+func origin(in discord.Incoming) (guildID, channelID string) {
+	switch in := in.(type) {
+	case *discord.Message:
+		return in.GuildID, in.ChannelID
+	case *discord.MessageEdit:
+		return in.GuildID, in.ChannelID
+	case *discord.MessageDelete:
+		return in.GuildID, in.ChannelID
+	case *discord.Reaction:
+		return in.GuildID, in.ChannelID
+	}
+
+	return "", ""
+}
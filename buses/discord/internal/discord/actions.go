@@ -5,39 +5,42 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"runtime"
 	"strings"
 	"time"
-
-	"github.com/mitchellh/mapstructure"
-	"nhooyr.io/websocket"
 )
 
 type arbitraryJSON = map[string]any
 
 type HelloData struct {
-	HeartbeatInterval int `mapstructure:"heartbeat_interval"`
+	HeartbeatInterval int `json:"heartbeat_interval"`
 }
 
-func (c *Client) doHello(ctx context.Context, event GatewayEvent) error {
+func (s *shard) doHello(ctx context.Context, cn *conn, event GatewayEvent) error {
 	var data HelloData
-	if err := mapstructure.Decode(event.Data, &data); err != nil {
+	if err := json.Unmarshal(event.Data, &data); err != nil {
 		return fmt.Errorf("bad hello decode: %w", err)
 	}
 
-	c.logger.Debug("got hello data", "interval", data.HeartbeatInterval)
+	s.logger.Debug("got hello data", "interval", data.HeartbeatInterval)
 
-	interval := time.Duration(data.HeartbeatInterval) * time.Millisecond
-	go c.runHeartbeatLoop(ctx, interval)
+	s.startHeartbeats(cn, time.Duration(data.HeartbeatInterval)*time.Millisecond)
 
-	return nil
+	if cn.state == stateResuming {
+		return s.doResume(ctx, cn)
+	}
+
+	return s.doIdentify(ctx, cn)
 }
 
-func (c *Client) sendHeartbeat(ctx context.Context, seq *int) {
+func (s *shard) sendHeartbeat(ctx context.Context, cn *conn) error {
+	seq := s.session.seq
+
 	pretty := "<nil>"
 	if seq != nil {
 		pretty = fmt.Sprint(*seq)
 	}
-	c.logger.Debug("will send heartbeat", "data", pretty)
+	s.logger.Debug("will send heartbeat", "data", pretty)
 
 	outgoing := map[string]any{
 		"op": Heartbeat,
@@ -45,110 +48,148 @@ func (c *Client) sendHeartbeat(ctx context.Context, seq *int) {
 	}
 	data, _ := json.Marshal(outgoing)
 
-	c.state.acked = false
-	c.write(ctx, data)
+	cn.acked = false
+	cn.lastBeat = time.Now()
+	s.health.beatSent(cn.lastBeat)
+
+	return s.write(ctx, cn, data)
 }
 
-func (c *Client) ackHeartbeat(ctx context.Context, event GatewayEvent) error {
-	c.state.acked = true
-	return nil
+func (s *shard) ackHeartbeat(cn *conn) {
+	cn.acked = true
+	s.health.beatAcked()
+
+	if !cn.lastBeat.IsZero() {
+		s.client.metrics.HeartbeatLatency.Observe(time.Since(cn.lastBeat).Seconds())
+	}
 }
 
-const intents = GuildMessages | GuildMessageReactions | DirectMessages | DirectMessageReactions
+func (s *shard) doIdentify(ctx context.Context, cn *conn) error {
+	if err := s.client.identify.wait(ctx, s.id); err != nil {
+		return err
+	}
 
-func (c *Client) doIdentify(ctx context.Context) {
 	outgoing := arbitraryJSON{
 		"op": Identify,
 		"d": arbitraryJSON{
-			"token":   c.token,
-			"intents": intents,
+			"token":   s.client.token,
+			"intents": s.client.intents,
+			"shard":   [2]int{s.id, s.count},
 			"properties": arbitraryJSON{
-				"os":      "macos",
+				"os":      runtime.GOOS,
 				"browser": "marvin",
 				"device":  "marvin",
 			},
-			"presence": arbitraryJSON{
-				"status":     "online",
-				"activities": []string{},
-				"afk":        false,
-			},
+			"presence": s.client.currentPresence(),
 		},
 	}
 
 	data, _ := json.Marshal(outgoing)
 
-	c.logger.Debug("will identify")
-	c.write(ctx, data)
+	s.logger.Debug("will identify")
+	s.setConnState(cn, stateIdentifying)
+	return s.write(ctx, cn, data)
 }
 
-func (c *Client) handleReady(event *GatewayEvent) error {
+func (s *shard) doResume(ctx context.Context, cn *conn) error {
+	data, _ := json.Marshal(arbitraryJSON{
+		"op": Resume,
+		"d": GatewayResume{
+			Token:     s.client.token,
+			SessionID: s.session.id,
+			Seq:       s.session.seq,
+		},
+	})
+
+	s.logger.Debug("will resume", "session", s.session.id)
+	return s.write(ctx, cn, data)
+}
+
+func (s *shard) handleReady(cn *conn, event *GatewayEvent) error {
 	var ready Ready
-	err := mapstructure.Decode(event.Data, &ready)
+	err := json.Unmarshal(event.Data, &ready)
 	if err != nil {
 		return fmt.Errorf("failed to decode ready event: %w", err)
 	}
 
-	c.state.resumeURL = ready.ResumeGatewayURL
-	c.state.sessionID = ready.SessionID
+	s.session.resumeURL = ready.ResumeGatewayURL
+	s.session.id = ready.SessionID
+	s.userID = ready.User.ID
+	s.setConnState(cn, stateReady)
 	return nil
 }
 
-func (c *Client) maybeResume(ctx context.Context, err websocket.CloseError) error {
-	switch err.Code {
-	case AuthenticationFailed, InvalidShard, ShardingRequired,
-		InvalidAPIVersion, InvalidIntent, DisallowedIntent:
-		return err
+func (s *shard) handleMessage(event *GatewayEvent) (Incoming, error) {
+	var message Message
+	err := json.Unmarshal(event.Data, &message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode message: %w", err)
 	}
 
-	return c.resume(ctx)
+	s.warnIfContentMissing(&message)
+	return &message, nil
 }
 
-func (c *Client) resume(ctx context.Context) error {
-	rctx, cancel := reconnectContext(ctx)
-	defer cancel()
-
-	c.logger.Info("resuming websocket connection")
-	conn, _, err := websocket.Dial(rctx, c.state.resumeURL, nil)
-	if err != nil {
-		return fmt.Errorf("could not reconnect to websocket: %w", err)
+// warnIfContentMissing warns, once, about a guild message that has nothing
+// in it, which is what they look like when we don't have the message_content
+// intent. (Messages mentioning us, and our own, always have their content.)
+func (s *shard) warnIfContentMissing(msg *Message) {
+	if msg.GuildID == "" || msg.Author.ID == s.userID || !msg.empty() {
+		return
 	}
 
-	c.ws = conn
+	for _, user := range msg.Mentions {
+		if user.ID == s.userID {
+			return
+		}
+	}
 
-	data, _ := json.Marshal(arbitraryJSON{
-		"op": Resume,
-		"d": GatewayResume{
-			Token:     c.token,
-			SessionID: c.state.sessionID,
-			Seq:       c.state.seq,
-		},
+	s.client.contentWarning.Do(func() {
+		s.logger.Warn("got a guild message without content; is the message_content intent enabled for this bot in the developer portal?",
+			"channel_id", msg.ChannelID,
+		)
 	})
-
-	c.write(rctx, data)
-	return nil
 }
 
-func (c *Client) reconnect(ctx context.Context) error {
-	c.reconnecting <- struct{}{}
-	c.state = clientState{
-		gatewayURL: c.state.gatewayURL,
+func (s *shard) handleEdit(event *GatewayEvent) (Incoming, error) {
+	var edit MessageEdit
+	err := json.Unmarshal(event.Data, &edit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode message update: %w", err)
 	}
 
-	rctx, cancel := reconnectContext(ctx)
-	defer cancel()
+	// Discord also sends updates when it fills in embeds, which nobody
+	// edited; those don't have an edit timestamp.
+	if edit.EditedTimestamp == "" {
+		return nil, nil
+	}
 
-	c.logger.Info("reconnecting websocket connection")
-	return c.Connect(rctx)
+	return &edit, nil
 }
 
-func (c *Client) handleMessage(event *GatewayEvent) (*Message, error) {
-	var message Message
-	err := mapstructure.Decode(event.Data, &message)
+func (s *shard) handleDelete(event *GatewayEvent) (Incoming, error) {
+	var del MessageDelete
+	err := json.Unmarshal(event.Data, &del)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode message: %w", err)
+		return nil, fmt.Errorf("failed to decode message delete: %w", err)
 	}
 
-	return &message, nil
+	return &del, nil
+}
+
+func (s *shard) handleReaction(event *GatewayEvent) (Incoming, error) {
+	var reaction Reaction
+	err := json.Unmarshal(event.Data, &reaction)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode reaction: %w", err)
+	}
+
+	// Our own reactions come back to us, too.
+	if reaction.UserID == s.userID {
+		return nil, nil
+	}
+
+	return &reaction, nil
 }
 
 func (c *Client) DecodeFormatting(msg Message) string {
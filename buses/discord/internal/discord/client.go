@@ -2,48 +2,50 @@ package discord
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
-	"time"
+	"sync"
 
 	"nhooyr.io/websocket"
 )
 
+// Client is a connection to Discord: the REST API, and one gateway
+// connection per shard, whose messages it merges into a single stream.
 type Client struct {
-	Err error // set on fatal errors
+	Err error // set on fatal errors, before Fatal's channel is closed
 
 	// these are passed in and stashed
-	token  string
-	logger *slog.Logger
-
-	// persistent state
-	ws    *websocket.Conn
-	state clientState
-
-	// communication channels
+	token        string
+	logger       *slog.Logger
+	apiBase      string
+	gatewayURL   string
+	fixedGateway string // from SetGatewayURL; if set, we don't ask Discord
+	compress     bool
+	shardCount   int // zero means however many Discord recommends
+	intents      Intent
+
+	mu       sync.Mutex // protects shards and presence
+	shards   []*shard
+	presence Presence
+	identify *identifyLimiter
+	metrics  Metrics
+
+	dieOnce       sync.Once
 	fatalNotifier chan struct{} // closed when we die, which sets .Err
-	errors        chan error    // over which we send non-fatal errors
-	reconnecting  chan struct{} // used to signal the heartbeat loop to shut down
-}
 
-type clientState struct {
-	identified bool
-	acked      bool
-	seq        *int
-	sessionID  string
-	gatewayURL string
-	resumeURL  string
+	contentWarning sync.Once // see warnIfContentMissing
 }
 
 func NewClient(logger *slog.Logger, token string) *Client {
 	return &Client{
 		token:         token,
 		logger:        logger,
+		apiBase:       DefaultAPIBase,
+		intents:       DefaultIntents,
 		fatalNotifier: make(chan struct{}),
-		reconnecting:  make(chan struct{}),
-		errors:        make(chan error),
+		metrics:       unregisteredMetrics(),
+		presence:      Presence{Status: "online", Activities: []Activity{}},
 	}
 }
 
@@ -51,197 +53,200 @@ func (c *Client) Fatal() <-chan struct{} {
 	return c.fatalNotifier
 }
 
-func (c *Client) Errors() <-chan error {
-	return c.errors
+// SetShards sets how many shards to run, instead of using the number Discord
+// recommends.
+func (c *Client) SetShards(n int) {
+	c.shardCount = n
 }
 
+// SetIntents sets which gateway intents to identify with, instead of
+// DefaultIntents.
+func (c *Client) SetIntents(intents Intent) {
+	c.intents = intents
+}
+
+// Connect finds out how to connect to the gateway, and dials it once for
+// each shard. It must be called before Run.
 func (c *Client) Connect(ctx context.Context) error {
-	if err := c.loadGatewayURL(); err != nil {
+	info, err := c.loadGateway(ctx)
+	if err != nil {
 		return err
 	}
 
-	conn, _, err := websocket.Dial(ctx, c.state.gatewayURL, nil)
-	if err != nil {
-		return fmt.Errorf("could not connect to websocket: %w", err)
+	count := info.Shards
+	if c.shardCount > 0 {
+		count = c.shardCount
 	}
 
-	c.ws = conn
-	return nil
+	if !c.intents.Has(MessageContent) {
+		c.logger.Warn("not asking for the message_content intent; guild messages will be empty unless they mention us")
+	}
+
+	return c.startShards(ctx, info, count)
 }
 
-var errFrameNotText = errors.New("got binary websocket type")
+// startShards dials a fresh set of count shards, and replaces whatever
+// shards we had with them.
+func (c *Client) startShards(ctx context.Context, info gatewayInfo, count int) error {
+	count = max(count, 1)
+	limit := info.SessionStartLimit
+
+	if limit.Remaining > 0 && limit.Remaining < count {
+		c.logger.Warn("not enough session starts left for every shard",
+			"shards", count,
+			"remaining", limit.Remaining,
+			"reset_after_ms", limit.ResetAfter,
+		)
+	}
 
-func (c *Client) Run(ctx context.Context, dataCh chan<- Message, errCh chan<- error) {
-	defer c.ws.Close(websocket.StatusNormalClosure, "so long")
+	c.gatewayURL = info.URL
 
-	var closeErr websocket.CloseError
+	// If we're starting over, keep the old limiter so that shards that
+	// just identified still count against it.
+	if c.identify == nil || c.identify.concurrency != max(limit.MaxConcurrency, 1) {
+		c.identify = newIdentifyLimiter(limit.MaxConcurrency)
+	}
 
-	for {
-		// c.logger.Debug("will read from websocket")
-		readCtx, cancel := context.WithTimeout(ctx, 45*time.Second)
-		typ, data, err := c.ws.Read(readCtx)
-		cancel()
-
-		switch {
-		case errors.Is(err, context.Canceled):
-			// this is fine.
-		case errors.As(err, &closeErr):
-			err = c.maybeResume(ctx, closeErr)
-			if err == nil {
-				continue
-			}
+	c.logger.Info("connecting to gateway", "shards", count, "max_concurrency", c.identify.concurrency)
 
-			fallthrough
-		case err != nil:
-			c.Err = fmt.Errorf("ws read error: %w", err)
-			close(c.fatalNotifier)
-			return
-		case typ != websocket.MessageText:
-			errCh <- errFrameNotText
-		}
+	shards := make([]*shard, 0, count)
+
+	for id := 0; id < count; id++ {
+		s := newShard(c, id, count)
+		s.health.setState(stateConnecting)
 
-		select {
-		case <-ctx.Done():
-			return
-		case <-c.fatalNotifier:
-			return
-		default:
-			evt, err := c.handleFrame(ctx, data)
-
-			switch {
-			case err != nil:
-				errCh <- err
-			case evt != nil:
-				dataCh <- *evt
+		if err := s.dial(ctx, c.gatewayURL); err != nil {
+			for _, open := range shards {
+				open.ws.Close(websocket.StatusGoingAway, "giving up on connecting")
 			}
+
+			return err
 		}
+
+		shards = append(shards, s)
 	}
+
+	c.mu.Lock()
+	c.shards = shards
+	c.mu.Unlock()
+
+	return nil
 }
 
-func (c *Client) handleFrame(ctx context.Context, data []byte) (*Message, error) {
-	var event GatewayEvent
-	if err := json.Unmarshal(data, &event); err != nil {
-		return nil, fmt.Errorf("bad frame from discord: %w", err)
+// reshard asks Discord how many shards we ought to be running, after it's
+// told us that the number we are running is wrong, and starts that many.
+// A shard count we were given with SetShards is no good anymore, since
+// Discord's just turned it down.
+func (c *Client) reshard(ctx context.Context) error {
+	info, err := c.fetchGateway(ctx)
+	if err != nil {
+		return fmt.Errorf("could not reshard: %w", err)
 	}
 
-	if event.Seq != nil {
-		c.state.seq = event.Seq
+	if c.fixedGateway != "" {
+		info.URL = c.fixedGateway
 	}
 
-	switch event.Op {
-	case Hello:
-		err := c.doHello(ctx, event)
-		return nil, err
-
-	case Heartbeat:
-		c.sendHeartbeat(ctx, c.state.seq)
-		return nil, nil
-
-	case HeartbeatACK:
-		if !c.state.identified {
-			c.doIdentify(ctx)
-			c.state.identified = true
-		}
+	old := len(c.allShards())
+	if max(info.Shards, 1) == old {
+		return fmt.Errorf("discord turned down %d shards, but that's how many it recommends", old)
+	}
 
-		err := c.ackHeartbeat(ctx, event)
-		return nil, err
+	c.logger.Warn("discord wants a different number of shards; starting over",
+		"old", old,
+		"new", info.Shards,
+	)
 
-	case Reconnect:
-		return nil, c.resume(ctx)
+	c.shardCount = 0
+	return c.startShards(ctx, info, info.Shards)
+}
 
-	case InvalidSession:
-		canResume, ok := event.Data.(bool)
-		if !ok {
-			return nil, fmt.Errorf("got an InvalidSession op with bad data: %+v", event.Data)
+// Run runs every shard until ctx is cancelled or one of them goes
+// irrecoverably wrong, in which case it sets Err, closes Fatal's channel, and
+// stops the rest. What comes in on all the shards is sent to dataCh, and
+// non-fatal errors to errCh. If Discord says we're running the wrong number
+// of shards, we stop them all and start over with however many it wants.
+func (c *Client) Run(ctx context.Context, dataCh chan<- Incoming, errCh chan<- error) {
+	for {
+		err := c.runShards(ctx, dataCh, errCh)
+		if errors.Is(err, errReshard) {
+			report(ctx, errCh, err)
+			err = c.reshard(ctx)
+			if err == nil {
+				continue
+			}
 		}
 
-		if canResume {
-			return nil, c.resume(ctx)
+		if err != nil && ctx.Err() == nil {
+			c.die(err)
 		}
 
-		return nil, c.reconnect(ctx)
-
-	case Dispatch:
-		return c.dispatch(ctx, &event)
-
-	default:
-		c.logger.Debug("ignoring gateway event", "type", event.Op)
-		fmt.Printf("  frame: %s\n", string(data))
-		return nil, nil
+		return
 	}
 }
 
-func reconnectContext(ctx context.Context) (context.Context, context.CancelFunc) {
-	return context.WithTimeout(ctx, 15*time.Second)
-}
+// runShards runs the current shards until ctx is cancelled, or one of them
+// stops, in which case it stops the rest and returns why.
+func (c *Client) runShards(ctx context.Context, dataCh chan<- Incoming, errCh chan<- error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-func (c *Client) dispatch(ctx context.Context, evt *GatewayEvent) (*Message, error) {
-	switch evt.Type {
-	case TypeReady:
-		return nil, c.handleReady(evt)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var stopped error
 
-	case TypeMessageCreate:
-		return c.handleMessage(evt)
+	for _, s := range c.allShards() {
+		wg.Add(1)
 
-	case TypeResumed:
-		c.logger.Debug("finished resuming")
-		return nil, nil
+		go func(s *shard) {
+			defer wg.Done()
 
-	default:
-		c.logger.Debug("ignoring dispatch event", "type", evt.Type)
+			if err := s.run(ctx, dataCh, errCh); err != nil {
+				if s.count > 1 {
+					err = fmt.Errorf("shard %d: %w", s.id, err)
+				}
+
+				once.Do(func() { stopped = err })
+				cancel()
+			}
+		}(s)
 	}
 
-	return nil, nil
+	wg.Wait()
+	return stopped
 }
 
-func (c *Client) runHeartbeatLoop(ctx context.Context, interval time.Duration) {
-	// jitter := rand.Float64()
-	jitter := 0.09
-	firstInterval := time.Duration(float64(interval) * jitter)
-	c.logger.Debug("waiting to send first heartbeat", "interval", firstInterval)
+func (c *Client) die(err error) {
+	c.dieOnce.Do(func() {
+		c.Err = err
+		close(c.fatalNotifier)
+	})
+}
 
-	timer := time.NewTimer(firstInterval)
-	first := true
+func (c *Client) allShards() []*shard {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	shutdown := func(reason string) {
-		c.logger.Debug("shutting down heartbeat loop", "reason", reason)
-		timer.Stop()
-	}
+	return c.shards
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			shutdown("context cancelled")
-			return
-		case <-c.reconnecting:
-			shutdown("reconnecting")
-			return
-
-		case <-timer.C:
-			if !c.state.acked && !first {
-				c.errors <- fmt.Errorf("failed to receive ack for last heartbeat")
-
-				if err := c.resume(ctx); err != nil {
-					c.Err = fmt.Errorf("failed to reconnect after lost ack: %w", err)
-					c.fatalNotifier <- struct{}{}
-				}
+// Healthy returns nil if every shard has received READY from the gateway and
+// is getting its heartbeats acked.
+func (c *Client) Healthy() error {
+	shards := c.allShards()
+	if len(shards) == 0 {
+		return errors.New("not connected to the gateway")
+	}
 
-				continue
+	for _, s := range shards {
+		if err := s.health.check(); err != nil {
+			if len(shards) > 1 {
+				return fmt.Errorf("shard %d: %w", s.id, err)
 			}
 
-			c.sendHeartbeat(ctx, c.state.seq)
-			timer.Reset(interval)
-			first = false
+			return err
 		}
 	}
-}
-
-func (c *Client) write(ctx context.Context, data []byte) {
-	writeCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
-	defer cancel()
 
-	err := c.ws.Write(writeCtx, websocket.MessageText, data)
-	if err != nil {
-		c.errors <- fmt.Errorf("bad websocket write: %w", err)
-	}
+	return nil
 }
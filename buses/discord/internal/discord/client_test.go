@@ -0,0 +1,759 @@
+package discord
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mmcclimon/marvin/buses/discord/internal/fakediscord"
+)
+
+const testToken = "test-token"
+
+func TestMain(m *testing.M) {
+	// Discord only lets us identify every five seconds, but the fake one
+	// doesn't mind.
+	identifyInterval = 0
+
+	os.Exit(m.Run())
+}
+
+type testClient struct {
+	*Client
+	incoming chan Incoming
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// startClient connects a client to srv, finding the gateway through the REST
+// API, and runs it until the test finishes. Any setup functions are called
+// on the client before it connects.
+func startClient(t *testing.T, srv *fakediscord.Server, setup ...func(*Client)) *testClient {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	c := NewClient(logger, testToken)
+	c.SetAPIBase(srv.APIBase)
+
+	for _, f := range setup {
+		f(c)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	if err := c.Connect(ctx); err != nil {
+		cancel()
+		t.Fatalf("could not connect: %s", err)
+	}
+
+	done := make(chan struct{})
+	errs := make(chan error)
+	tc := &testClient{
+		Client:   c,
+		incoming: make(chan Incoming, 16),
+		cancel:   cancel,
+		done:     done,
+	}
+
+	go func() {
+		defer close(done)
+		c.Run(ctx, tc.incoming, errs)
+	}()
+
+	// Nobody's checking for errors here, but they have to go somewhere.
+	go func() {
+		for {
+			select {
+			case err := <-errs:
+				t.Logf("client error: %s", err)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return tc
+}
+
+// handshake walks a fresh connection through hello, identify, and ready,
+// and returns the identify frame.
+func handshake(t *testing.T, conn *fakediscord.Conn) fakediscord.Frame {
+	t.Helper()
+
+	conn.SendHello(time.Second)
+	identify := conn.Expect(fakediscord.OpIdentify)
+	conn.SendReady("session-1")
+
+	return identify
+}
+
+func (tc *testClient) expectMessage(t *testing.T) Message {
+	t.Helper()
+
+	msg, ok := tc.expectIncoming(t).(*Message)
+	if !ok {
+		t.Fatalf("got %T, wanted a message", msg)
+	}
+
+	return *msg
+}
+
+func (tc *testClient) expectIncoming(t *testing.T) Incoming {
+	t.Helper()
+
+	select {
+	case in := <-tc.incoming:
+		return in
+	case <-time.After(fakediscord.Timeout):
+		t.Fatal("timed out waiting for something from the gateway")
+		return nil
+	}
+}
+
+func (tc *testClient) waitState(t *testing.T, want connState) {
+	t.Helper()
+	tc.waitShardState(t, tc.allShards()[0], want)
+}
+
+func (tc *testClient) waitShardState(t *testing.T, s *shard, want connState) {
+	t.Helper()
+
+	deadline := time.Now().Add(fakediscord.Timeout)
+	for {
+		got := s.health.connState()
+		if got == want {
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("shard %d is %s, wanted %s", s.id, got, want)
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	srv := fakediscord.NewServer(t)
+	client := startClient(t, srv)
+
+	conn := srv.NextConn()
+	if v, enc := conn.Query.Get("v"), conn.Query.Get("encoding"); v != "10" || enc != "json" {
+		t.Errorf("connected with v=%q encoding=%q, wanted v=10 encoding=json", v, enc)
+	}
+
+	if conn.Query.Has("compress") {
+		t.Errorf("asked for compression without being told to")
+	}
+
+	identify := handshake(t, conn)
+
+	var data struct {
+		Token   string `json:"token"`
+		Intents Intent `json:"intents"`
+	}
+
+	identify.Decode(t, &data)
+
+	if data.Token != testToken {
+		t.Errorf("identified with token %q, wanted %q", data.Token, testToken)
+	}
+
+	if data.Intents != DefaultIntents {
+		t.Errorf("identified with intents %d, wanted %d", data.Intents, DefaultIntents)
+	}
+
+	client.waitState(t, stateReady)
+
+	if err := client.Healthy(); err != nil {
+		t.Errorf("client isn't healthy after handshake: %s", err)
+	}
+}
+
+func TestSetIntents(t *testing.T) {
+	srv := fakediscord.NewServer(t)
+	want := GuildMessages | DirectMessages
+
+	startClient(t, srv, func(c *Client) { c.SetIntents(want) })
+
+	var data struct {
+		Intents Intent `json:"intents"`
+	}
+
+	handshake(t, srv.NextConn()).Decode(t, &data)
+
+	if data.Intents != want {
+		t.Errorf("identified with intents %d, wanted %d", data.Intents, want)
+	}
+}
+
+func TestParseIntents(t *testing.T) {
+	got, err := ParseIntents([]string{"guild_messages", "message_content", "guild_messages"})
+	if err != nil {
+		t.Fatalf("couldn't parse intents: %s", err)
+	}
+
+	if want := GuildMessages | MessageContent; got != want {
+		t.Errorf("got intents %d, wanted %d", got, want)
+	}
+
+	if _, err := ParseIntents([]string{"guild_mesages"}); err == nil {
+		t.Error("parsed a misspelled intent")
+	}
+}
+
+// lockedBuffer is a buffer that loggers on different goroutines can share.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestMissingContentWarning(t *testing.T) {
+	srv := fakediscord.NewServer(t)
+
+	var logs lockedBuffer
+	client := startClient(t, srv, func(c *Client) {
+		c.logger = slog.New(slog.NewTextHandler(&logs, nil))
+		c.SetIntents(GuildMessages)
+	})
+
+	if !strings.Contains(logs.String(), "not asking for the message_content intent") {
+		t.Errorf("didn't warn about the missing intent on connecting; logs:\n%s", logs.String())
+	}
+
+	conn := srv.NextConn()
+	handshake(t, conn)
+
+	conn.SendMessageCreate("123", "arthur", "")
+	client.expectMessage(t)
+	conn.SendMessageCreate("123", "arthur", "")
+	client.expectMessage(t)
+
+	if n := strings.Count(logs.String(), "got a guild message without content"); n != 1 {
+		t.Errorf("warned about empty messages %d times, wanted once; logs:\n%s", n, logs.String())
+	}
+}
+
+func TestDisallowedIntent(t *testing.T) {
+	srv := fakediscord.NewServer(t)
+	client := startClient(t, srv)
+
+	conn := srv.NextConn()
+	conn.SendHello(time.Second)
+	conn.Expect(fakediscord.OpIdentify)
+	conn.Close(int(DisallowedIntent), "disallowed intent(s)")
+
+	select {
+	case <-client.Fatal():
+	case <-time.After(fakediscord.Timeout):
+		t.Fatal("client didn't die after being refused its intents")
+	}
+
+	if client.Err == nil || !strings.Contains(client.Err.Error(), "developer portal") {
+		t.Errorf("client died with unhelpful error %v", client.Err)
+	}
+}
+
+func TestMessageCreate(t *testing.T) {
+	srv := fakediscord.NewServer(t)
+	client := startClient(t, srv)
+
+	conn := srv.NextConn()
+	handshake(t, conn)
+
+	conn.SendMessageCreate("123", "arthur", "hello, marvin")
+	msg := client.expectMessage(t)
+
+	if msg.Content != "hello, marvin" || msg.ChannelID != "123" || msg.Author.Username != "arthur" {
+		t.Errorf("got unexpected message %+v", msg)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	srv := fakediscord.NewServer(t)
+	client := startClient(t, srv, func(c *Client) { c.SetCompression(true) })
+
+	conn := srv.NextConn()
+	if got := conn.Query.Get("compress"); got != "zlib-stream" {
+		t.Fatalf("connected with compress=%q, wanted zlib-stream", got)
+	}
+
+	handshake(t, conn)
+	client.waitState(t, stateReady)
+
+	// Several payloads, so that the later ones depend on the earlier ones'
+	// compression context.
+	for _, text := range []string{"hello", "hello, marvin", "hello, marvin"} {
+		conn.SendMessageCreate("123", "arthur", text)
+
+		if msg := client.expectMessage(t); msg.Content != text {
+			t.Errorf("got message %q, wanted %q", msg.Content, text)
+		}
+	}
+
+	// Close codes have to make it through the decompressor, too; this one
+	// means resume, and the new connection gets a fresh zlib stream.
+	conn.Close(4000, "unknown error")
+
+	next := srv.NextConn()
+	if got := next.Query.Get("compress"); got != "zlib-stream" {
+		t.Errorf("resumed with compress=%q, wanted zlib-stream", got)
+	}
+
+	next.SendHello(time.Second)
+	next.Expect(fakediscord.OpResume)
+	next.Dispatch("RESUMED", nil)
+	client.waitState(t, stateReady)
+
+	next.SendMessageCreate("123", "arthur", "still here?")
+	client.expectMessage(t)
+}
+
+func TestSharding(t *testing.T) {
+	srv := fakediscord.NewServer(t)
+	srv.Shards = 3
+	client := startClient(t, srv)
+
+	var ids []int
+
+	for i := 0; i < 3; i++ {
+		conn := srv.NextConn()
+
+		var identify struct {
+			Shard [2]int `json:"shard"`
+		}
+
+		handshake(t, conn).Decode(t, &identify)
+
+		if identify.Shard[1] != 3 {
+			t.Errorf("identified with shard %v, wanted a count of 3", identify.Shard)
+		}
+
+		ids = append(ids, identify.Shard[0])
+
+		// Every shard's messages come out of the same client.
+		conn.SendMessageCreate("123", "arthur", "hello")
+		client.expectMessage(t)
+	}
+
+	srv.ExpectNoConn(100 * time.Millisecond)
+
+	slices.Sort(ids)
+	if !slices.Equal(ids, []int{0, 1, 2}) {
+		t.Errorf("identified shards %v, wanted 0 through 2", ids)
+	}
+
+	for _, s := range client.allShards() {
+		client.waitShardState(t, s, stateReady)
+	}
+
+	if err := client.Healthy(); err != nil {
+		t.Errorf("client isn't healthy with every shard ready: %s", err)
+	}
+}
+
+func TestShardCountOverride(t *testing.T) {
+	srv := fakediscord.NewServer(t)
+	srv.Shards = 3
+	startClient(t, srv, func(c *Client) { c.SetShards(2) })
+
+	srv.NextConn()
+	srv.NextConn()
+	srv.ExpectNoConn(100 * time.Millisecond)
+}
+
+func TestIdentifyConcurrency(t *testing.T) {
+	limiter := newIdentifyLimiter(2)
+	limiter.interval = 50 * time.Millisecond
+
+	ctx := context.Background()
+	start := time.Now()
+
+	// Shards 0 and 1 are in different buckets, so they go right away; 2
+	// shares a bucket with 0, so it has to wait.
+	for _, shard := range []int{0, 1} {
+		if err := limiter.wait(ctx, shard); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if waited := time.Since(start); waited >= limiter.interval {
+		t.Errorf("first shards in each bucket waited %s", waited)
+	}
+
+	if err := limiter.wait(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if waited := time.Since(start); waited < limiter.interval {
+		t.Errorf("second shard in a bucket only waited %s", waited)
+	}
+}
+
+func TestPresence(t *testing.T) {
+	initial, err := NewPresence("idle", "playing", "chess")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := fakediscord.NewServer(t)
+	client := startClient(t, srv, func(c *Client) { c.SetPresence(initial) })
+
+	conn := srv.NextConn()
+
+	var identify struct {
+		Presence   Presence          `json:"presence"`
+		Properties map[string]string `json:"properties"`
+	}
+
+	handshake(t, conn).Decode(t, &identify)
+
+	if identify.Properties["os"] != runtime.GOOS {
+		t.Errorf("identified with os %q, wanted %q", identify.Properties["os"], runtime.GOOS)
+	}
+
+	if !reflect.DeepEqual(identify.Presence, initial) {
+		t.Errorf("identified with presence %+v, wanted %+v", identify.Presence, initial)
+	}
+
+	client.waitState(t, stateReady)
+
+	deploying, err := NewPresence("", "watching", "deploy #123")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.SetPresence(deploying)
+
+	var update Presence
+	conn.Expect(fakediscord.OpPresenceUpdate).Decode(t, &update)
+
+	if !reflect.DeepEqual(update, deploying) {
+		t.Errorf("updated presence to %+v, wanted %+v", update, deploying)
+	}
+}
+
+func TestNewPresence(t *testing.T) {
+	p, err := NewPresence("", "custom", "thinking")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Presence{
+		Status:     "online",
+		Activities: []Activity{{Name: "Custom Status", Type: ActivityCustom, State: "thinking"}},
+	}
+
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("got presence %+v, wanted %+v", p, want)
+	}
+
+	for _, bad := range [][3]string{
+		{"sleepy", "", ""},
+		{"", "dancing", "the tango"},
+		{"", "playing", ""},
+	} {
+		if _, err := NewPresence(bad[0], bad[1], bad[2]); err == nil {
+			t.Errorf("NewPresence%q didn't fail", bad)
+		}
+	}
+}
+
+func TestReactionAdd(t *testing.T) {
+	srv := fakediscord.NewServer(t)
+	client := startClient(t, srv)
+
+	conn := srv.NextConn()
+	handshake(t, conn)
+
+	// Our own reaction (the fake's bot user is id 1) should be dropped, so
+	// only the second one comes through.
+	conn.SendReactionAdd("123", "100", "1", "marvin", "👍")
+	conn.SendReactionAdd("123", "100", "2", "arthur", "✅")
+
+	reaction, ok := client.expectIncoming(t).(*Reaction)
+	if !ok {
+		t.Fatalf("got %T, wanted a reaction", reaction)
+	}
+
+	if reaction.MessageID != "100" || reaction.Emoji.String() != "✅" || reaction.Member.User.Username != "arthur" {
+		t.Errorf("got unexpected reaction %+v", reaction)
+	}
+}
+
+func TestMessageUpdateAndDelete(t *testing.T) {
+	srv := fakediscord.NewServer(t)
+	client := startClient(t, srv)
+
+	conn := srv.NextConn()
+	handshake(t, conn)
+
+	// Discord sends updates without an edit timestamp when it fills in
+	// embeds; those shouldn't come through.
+	conn.Dispatch("MESSAGE_UPDATE", map[string]any{"id": "100", "channel_id": "123", "embeds": []any{}})
+	conn.SendMessageUpdate("123", "100", "arthur", "hello, marvin")
+
+	edit, ok := client.expectIncoming(t).(*MessageEdit)
+	if !ok {
+		t.Fatalf("got %T, wanted an edit", edit)
+	}
+
+	if edit.ID != "100" || edit.Content != "hello, marvin" {
+		t.Errorf("got unexpected edit %+v", edit)
+	}
+
+	conn.SendMessageDelete("123", "100")
+
+	del, ok := client.expectIncoming(t).(*MessageDelete)
+	if !ok {
+		t.Fatalf("got %T, wanted a delete", del)
+	}
+
+	if del.ID != "100" || del.ChannelID != "123" {
+		t.Errorf("got unexpected delete %+v", del)
+	}
+}
+
+func TestHeartbeatOnRequest(t *testing.T) {
+	srv := fakediscord.NewServer(t)
+	client := startClient(t, srv)
+
+	conn := srv.NextConn()
+	handshake(t, conn)
+
+	// READY was seq 1, so this is seq 2.
+	conn.SendMessageCreate("123", "arthur", "hello")
+	client.expectMessage(t)
+
+	conn.SendOp(fakediscord.OpHeartbeat, nil)
+
+	var seq int
+	conn.Expect(fakediscord.OpHeartbeat).Decode(t, &seq)
+
+	if seq != 2 {
+		t.Errorf("heartbeat sent seq %d, wanted 2", seq)
+	}
+}
+
+func TestResume(t *testing.T) {
+	tests := []struct {
+		name    string
+		trigger func(*fakediscord.Conn)
+	}{
+		{"reconnect op", func(c *fakediscord.Conn) { c.SendReconnect() }},
+		{"resumable invalid session", func(c *fakediscord.Conn) { c.SendInvalidSession(true) }},
+		{"resumable close code", func(c *fakediscord.Conn) { c.Close(4000, "unknown error") }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv := fakediscord.NewServer(t)
+			client := startClient(t, srv)
+
+			conn := srv.NextConn()
+			handshake(t, conn)
+
+			conn.SendMessageCreate("123", "arthur", "hello")
+			client.expectMessage(t)
+
+			test.trigger(conn)
+
+			next := srv.NextConn()
+			next.SendHello(time.Second)
+
+			var resume GatewayResume
+			next.Expect(fakediscord.OpResume).Decode(t, &resume)
+
+			if resume.Token != testToken || resume.SessionID != "session-1" {
+				t.Errorf("resumed with unexpected data %+v", resume)
+			}
+
+			if resume.Seq == nil || *resume.Seq != 2 {
+				t.Errorf("resumed with seq %v, wanted 2", resume.Seq)
+			}
+
+			if code := conn.ExpectClosed(); code == 1000 || code == 1001 {
+				t.Errorf("old connection closed with %d, which ends the session", code)
+			}
+
+			next.Dispatch("RESUMED", nil)
+			client.waitState(t, stateReady)
+
+			next.SendMessageCreate("123", "arthur", "still here?")
+			client.expectMessage(t)
+		})
+	}
+}
+
+func TestInvalidSessionReidentifies(t *testing.T) {
+	srv := fakediscord.NewServer(t)
+	startClient(t, srv)
+
+	conn := srv.NextConn()
+	handshake(t, conn)
+
+	conn.SendInvalidSession(false)
+
+	// A non-resumable session means starting over, from hello.
+	handshake(t, srv.NextConn())
+}
+
+func TestSessionTimeoutReidentifies(t *testing.T) {
+	srv := fakediscord.NewServer(t)
+	startClient(t, srv)
+
+	conn := srv.NextConn()
+	handshake(t, conn)
+
+	conn.Close(int(SessionTimedOut), "session timed out")
+	handshake(t, srv.NextConn())
+}
+
+func TestMissedAckResumes(t *testing.T) {
+	srv := fakediscord.NewServer(t)
+	client := startClient(t, srv)
+
+	conn := srv.NextConn()
+	conn.SendHello(50 * time.Millisecond)
+	conn.Expect(fakediscord.OpIdentify)
+	conn.SendReady("session-1")
+
+	// Ack the first heartbeat, but not the second.
+	conn.Expect(fakediscord.OpHeartbeat)
+	conn.SendHeartbeatACK()
+	conn.Expect(fakediscord.OpHeartbeat)
+
+	next := srv.NextConn()
+	client.waitState(t, stateResuming)
+
+	if client.Healthy() == nil {
+		t.Error("client reports itself healthy while resuming")
+	}
+
+	next.SendHello(time.Second)
+	next.Expect(fakediscord.OpResume)
+}
+
+func TestShutdown(t *testing.T) {
+	srv := fakediscord.NewServer(t)
+	client := startClient(t, srv)
+
+	conn := srv.NextConn()
+	handshake(t, conn)
+	client.waitState(t, stateReady)
+
+	client.cancel()
+	<-client.done
+
+	if code := conn.ExpectClosed(); code != 1000 {
+		t.Errorf("closed with status %d on shutdown, wanted 1000", code)
+	}
+
+	select {
+	case <-client.Fatal():
+		t.Error("shutting down counted as a fatal error")
+	default:
+	}
+
+	srv.ExpectNoConn(100 * time.Millisecond)
+}
+
+func TestFatalCloseCode(t *testing.T) {
+	srv := fakediscord.NewServer(t)
+	client := startClient(t, srv)
+
+	conn := srv.NextConn()
+	handshake(t, conn)
+
+	conn.Close(int(AuthenticationFailed), "authentication failed")
+
+	select {
+	case <-client.Fatal():
+	case <-time.After(fakediscord.Timeout):
+		t.Fatal("client didn't die after a fatal close code")
+	}
+
+	if client.Err == nil {
+		t.Error("client died without setting Err")
+	}
+
+	if client.Healthy() == nil {
+		t.Error("dead client still reports itself healthy")
+	}
+
+	srv.ExpectNoConn(100 * time.Millisecond)
+}
+
+func TestShardingRequired(t *testing.T) {
+	srv := fakediscord.NewServer(t)
+	client := startClient(t, srv, func(c *Client) { c.SetShards(1) })
+
+	conn := srv.NextConn()
+	handshake(t, conn)
+
+	srv.Shards = 2
+	conn.Close(int(ShardingRequired), "sharding required")
+
+	var ids []int
+
+	for i := 0; i < 2; i++ {
+		var identify struct {
+			Shard [2]int `json:"shard"`
+		}
+
+		conn := srv.NextConn()
+		handshake(t, conn).Decode(t, &identify)
+
+		if identify.Shard[1] != 2 {
+			t.Errorf("identified with shard %v, wanted a count of 2", identify.Shard)
+		}
+
+		ids = append(ids, identify.Shard[0])
+
+		conn.SendMessageCreate("123", "arthur", "hello")
+		client.expectMessage(t)
+	}
+
+	srv.ExpectNoConn(100 * time.Millisecond)
+
+	slices.Sort(ids)
+	if !slices.Equal(ids, []int{0, 1}) {
+		t.Errorf("identified shards %v, wanted 0 and 1", ids)
+	}
+
+	select {
+	case <-client.Fatal():
+		t.Fatalf("client died after being asked to reshard: %s", client.Err)
+	default:
+	}
+
+	for _, s := range client.allShards() {
+		client.waitShardState(t, s, stateReady)
+	}
+}
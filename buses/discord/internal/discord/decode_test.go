@@ -0,0 +1,63 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// A MESSAGE_CREATE roughly the shape of what Discord actually sends, most of
+// which we don't care about.
+var messageCreateFrame = []byte(`{"t":"MESSAGE_CREATE","s":42,"op":0,"d":{"type":0,"tts":false,"timestamp":"2024-01-05T17:35:47.981000+00:00","referenced_message":null,"pinned":false,"nonce":"1192898382428733440","mentions":[{"username":"marvin","public_flags":0,"id":"1180210375393812481","global_name":null,"discriminator":"0","bot":true,"avatar_decoration_data":null,"avatar":null}],"mention_roles":[],"mention_everyone":false,"member":{"roles":["1180210802973745213"],"premium_since":null,"pending":false,"nick":null,"mute":false,"joined_at":"2023-11-29T01:33:39.425000+00:00","flags":0,"deaf":false,"communication_disabled_until":null,"avatar":null},"id":"1192898384517484595","flags":0,"embeds":[],"edited_timestamp":null,"content":"<@1180210375393812481> hello there","components":[],"channel_id":"1180210803779063860","author":{"username":"arthur","public_flags":0,"id":"1180202546373955645","global_name":"Arthur Dent","discriminator":"0","avatar_decoration_data":null,"avatar":"a4b1b8b4e4e0c6b7e5f3a1d2c3b4a5f6"},"attachments":[],"guild_id":"1180210802973745213"}}`)
+
+func BenchmarkHandleMessageCreate(b *testing.B) {
+	c := NewClient(slog.New(slog.NewTextHandler(io.Discard, nil)), "token")
+	s := newShard(c, 0, 1)
+	cn := &conn{state: stateReady}
+	ctx := context.Background()
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		in, _, err := s.handleFrame(ctx, cn, messageCreateFrame)
+		if msg, ok := in.(*Message); err != nil || !ok || msg.Author.Username != "arthur" {
+			b.Fatalf("bad decode: %+v, %v", in, err)
+		}
+	}
+}
+
+// BenchmarkDecodeMessageCreateGeneric decodes the same frame the way we used
+// to, into an any and then through mapstructure, for comparison with the
+// above. Only the decoding is here, so it flatters the old way slightly.
+func BenchmarkDecodeMessageCreateGeneric(b *testing.B) {
+	type genericEvent struct {
+		Op   OpType
+		Data any       `json:"d"`
+		Seq  *int      `json:"s"`
+		Type EventType `json:"t"`
+	}
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		var event genericEvent
+		if err := json.Unmarshal(messageCreateFrame, &event); err != nil {
+			b.Fatal(err)
+		}
+
+		var msg struct {
+			ID        string
+			Author    struct{ Username string }
+			Content   string
+			ChannelID string `mapstructure:"channel_id"`
+		}
+
+		if err := mapstructure.Decode(event.Data, &msg); err != nil || msg.Author.Username != "arthur" {
+			b.Fatalf("bad decode: %+v, %v", msg, err)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package discord
 
-import "nhooyr.io/websocket"
+import (
+	"encoding/json"
+
+	"nhooyr.io/websocket"
+)
 
 type OpType int
 
@@ -31,17 +35,22 @@ const (
 	HeartbeatACK
 )
 
+// GatewayEvent is a gateway frame. Data is left undecoded until we know
+// what's in it, so that it can be decoded straight into the right type.
 type GatewayEvent struct {
-	Op   OpType
-	Data any       `json:"d"`
-	Seq  *int      `json:"s"`
-	Type EventType `json:"t,omitempty"`
+	Op   OpType          `json:"op"`
+	Data json.RawMessage `json:"d"`
+	Seq  *int            `json:"s"`
+	Type EventType       `json:"t,omitempty"`
 }
 
 type EventType string
 
 const (
 	TypeMessageCreate EventType = "MESSAGE_CREATE"
+	TypeMessageUpdate EventType = "MESSAGE_UPDATE"
+	TypeMessageDelete EventType = "MESSAGE_DELETE"
+	TypeReactionAdd   EventType = "MESSAGE_REACTION_ADD"
 	TypeReady         EventType = "READY"
 	TypeResumed       EventType = "RESUMED"
 )
@@ -0,0 +1,67 @@
+package discord
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// How long a heartbeat can go unacked before we consider ourselves unhealthy.
+const ackGracePeriod = 10 * time.Second
+
+// health mirrors the bits of the connection state that other goroutines want
+// to know about, behind a lock.
+type health struct {
+	mu       sync.Mutex
+	state    connState
+	acked    bool
+	lastBeat time.Time
+}
+
+func (h *health) setState(state connState) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.state = state
+}
+
+func (h *health) connState() connState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.state
+}
+
+func (h *health) beatSent(at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.acked = false
+	h.lastBeat = at
+}
+
+func (h *health) beatAcked() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.acked = true
+}
+
+// check returns nil if we've received READY from the gateway and it's
+// acking our heartbeats.
+func (h *health) check() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.state != stateReady {
+		return fmt.Errorf("gateway connection is %s", h.state)
+	}
+
+	if !h.acked && !h.lastBeat.IsZero() {
+		if waiting := time.Since(h.lastBeat); waiting > ackGracePeriod {
+			return fmt.Errorf("heartbeat not acked for %s", waiting.Truncate(time.Second))
+		}
+	}
+
+	return nil
+}
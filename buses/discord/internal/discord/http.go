@@ -5,68 +5,200 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
+	"strings"
 	"time"
 )
 
-const urlBase = "https://discord.com/api/v10"
+const DefaultAPIBase = "https://discord.com/api/v10"
 
 var httpClient = http.Client{Timeout: 5 * time.Second}
 
-func URLFor(endpoint string, args ...any) string {
-	return fmt.Sprintf(urlBase+endpoint, args...)
+// SetAPIBase points the client at a different REST API, which is mostly
+// useful for testing.
+func (c *Client) SetAPIBase(url string) {
+	c.apiBase = strings.TrimSuffix(url, "/")
 }
 
-func (c *Client) loadGatewayURL() error {
-	if c.state.gatewayURL != "" {
-		return nil // already cached
+// SetGatewayURL sets the gateway to connect to, instead of asking the REST
+// API for it.
+func (c *Client) SetGatewayURL(url string) {
+	c.fixedGateway = url
+}
+
+func (c *Client) URLFor(endpoint string, args ...any) string {
+	return fmt.Sprintf(c.apiBase+endpoint, args...)
+}
+
+// gatewayInfo is what GET /gateway/bot tells us about connecting.
+type gatewayInfo struct {
+	URL               string            `json:"url"`
+	Shards            int               `json:"shards"`
+	SessionStartLimit sessionStartLimit `json:"session_start_limit"`
+}
+
+type sessionStartLimit struct {
+	Total          int `json:"total"`
+	Remaining      int `json:"remaining"`
+	ResetAfter     int `json:"reset_after"` // milliseconds
+	MaxConcurrency int `json:"max_concurrency"`
+}
+
+// loadGateway asks Discord how to connect to the gateway, unless we've been
+// given a gateway URL, in which case we connect there with one shard (or
+// however many we were told to run).
+func (c *Client) loadGateway(ctx context.Context) (gatewayInfo, error) {
+	if c.fixedGateway != "" {
+		return gatewayInfo{
+			URL:               c.fixedGateway,
+			Shards:            1,
+			SessionStartLimit: sessionStartLimit{MaxConcurrency: 1},
+		}, nil
+	}
+
+	return c.fetchGateway(ctx)
+}
+
+// fetchGateway asks Discord how to connect to the gateway, with GET
+// /gateway/bot.
+func (c *Client) fetchGateway(ctx context.Context) (gatewayInfo, error) {
+	var info gatewayInfo
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.apiBase+"/gateway/bot", nil)
+	if err != nil {
+		return info, fmt.Errorf("bad request creation: %w", err)
 	}
 
-	resp, err := httpClient.Get(urlBase + "/gateway")
+	req.Header.Add("Authorization", "Bot "+c.token)
+
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("could not fetch gateway: %w", err)
+		return info, fmt.Errorf("could not fetch gateway: %w", err)
 	}
 
 	defer resp.Body.Close()
 
-	var data struct{ URL string }
-	err = json.NewDecoder(resp.Body).Decode(&data)
+	if resp.StatusCode != http.StatusOK {
+		return info, fmt.Errorf("could not fetch gateway: %s", resp.Status)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&info)
 	if err != nil {
-		return fmt.Errorf("could not read gateway response: %w", err)
+		return info, fmt.Errorf("could not read gateway response: %w", err)
 	}
 
-	c.state.gatewayURL = data.URL
-	return nil
+	return info, nil
 }
 
 func (c *Client) Post(ctx context.Context, url string, data any) (*http.Response, error) {
+	return c.sendJSON(ctx, http.MethodPost, url, data)
+}
+
+func (c *Client) Patch(ctx context.Context, url string, data any) (*http.Response, error) {
+	return c.sendJSON(ctx, http.MethodPatch, url, data)
+}
+
+// Put makes a PUT request with no body, which is how the API does things
+// like adding reactions.
+func (c *Client) Put(ctx context.Context, url string) (*http.Response, error) {
+	return c.request(ctx, http.MethodPut, url, "", nil)
+}
+
+func (c *Client) Delete(ctx context.Context, url string) (*http.Response, error) {
+	return c.request(ctx, http.MethodDelete, url, "", nil)
+}
+
+func (c *Client) sendJSON(ctx context.Context, method, url string, data any) (*http.Response, error) {
 	body, err := json.Marshal(data)
 	if err != nil {
 		return nil, fmt.Errorf("bad json encode: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(body))
+	return c.request(ctx, method, url, "application/json", bytes.NewBuffer(body))
+}
+
+// PostFiles posts data along with some files, which is how the API takes
+// uploads: data goes in a payload_json part, and the files after it.
+func (c *Client) PostFiles(ctx context.Context, url string, data any, files []File) (*http.Response, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("bad json encode: %w", err)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	if err := mw.WriteField("payload_json", string(payload)); err != nil {
+		return nil, fmt.Errorf("bad multipart encode: %w", err)
+	}
+
+	for i, file := range files {
+		part, err := mw.CreateFormFile(fmt.Sprintf("files[%d]", i), file.Name)
+		if err == nil {
+			_, err = part.Write(file.Content)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("bad multipart encode: %w", err)
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, fmt.Errorf("bad multipart encode: %w", err)
+	}
+
+	return c.request(ctx, http.MethodPost, url, mw.FormDataContentType(), &body)
+}
+
+func (c *Client) request(ctx context.Context, method, url, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return nil, fmt.Errorf("bad request creation: %w", err)
 	}
 
 	req.Header.Add("Authorization", "Bot "+c.token)
-	req.Header.Add("Content-Type", "application/json")
+
+	if contentType != "" {
+		req.Header.Add("Content-Type", contentType)
+	}
 
 	return httpClient.Do(req)
 }
 
-// This is obviously stupid.
-func (c *Client) CheckAPIResponse(resp *http.Response) {
-	defer resp.Body.Close()
-	var maybeErr map[string]any
+// APIError is an error response from the REST API.
+type APIError struct {
+	Status  int    `json:"-"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("discord api error %d (code %d): %s", e.Status, e.Code, e.Message)
+}
 
-	if err := json.NewDecoder(resp.Body).Decode(&maybeErr); err != nil {
-		c.logger.Warn("bad json decode of maybe-error", "error", err)
+// readResponse closes res, after decoding its body into v if the request
+// worked and v isn't nil. If it didn't work, it returns an *APIError.
+func readResponse(res *http.Response, v any) error {
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		apiErr := &APIError{Status: res.StatusCode}
+		if err := json.NewDecoder(res.Body).Decode(apiErr); err != nil {
+			apiErr.Message = res.Status
+		}
+
+		return apiErr
+	}
+
+	if v == nil {
+		return nil
 	}
 
-	_, hasErrors := maybeErr["errors"]
-	if hasErrors {
-		c.logger.Warn("bad json response", "response", maybeErr)
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return fmt.Errorf("bad json decode of response: %w", err)
 	}
+
+	return nil
 }
@@ -0,0 +1,58 @@
+package discord
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// identifyInterval is how often each bucket of shards may identify; it's a
+// variable so that tests don't have to wait around.
+var identifyInterval = 5 * time.Second
+
+// identifyLimiter enforces Discord's max_concurrency. Shards are put into
+// buckets by their id modulo max_concurrency, and only one shard in each
+// bucket may identify per identifyInterval.
+type identifyLimiter struct {
+	mu          sync.Mutex
+	concurrency int
+	interval    time.Duration
+	next        map[int]time.Time // by bucket
+}
+
+func newIdentifyLimiter(concurrency int) *identifyLimiter {
+	return &identifyLimiter{
+		concurrency: max(concurrency, 1),
+		interval:    identifyInterval,
+		next:        make(map[int]time.Time),
+	}
+}
+
+// wait blocks until the shard may identify, or ctx is done. The slot is
+// reserved as soon as wait is called, so shards in the same bucket go in the
+// order they asked.
+func (l *identifyLimiter) wait(ctx context.Context, shard int) error {
+	l.mu.Lock()
+	bucket := shard % l.concurrency
+	at := l.next[bucket]
+	if now := time.Now(); at.Before(now) {
+		at = now
+	}
+	l.next[bucket] = at.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := time.Until(at)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -1,5 +1,7 @@
 package discord
 
+import "fmt"
+
 type Intent int
 
 // taken from https://discord.com/developers/docs/topics/gateway#list-of-intents
@@ -21,6 +23,55 @@ const (
 	DirectMessageTyping
 	MessageContent
 	GuildScheduledEvents
-	AutoModerationConfiguration = 1 << 20
-	AutoModerationExecution     = 1 << 21
+	AutoModerationConfiguration Intent = 1 << 20
+	AutoModerationExecution     Intent = 1 << 21
 )
+
+// DefaultIntents are what we ask for unless told otherwise: messages and
+// reactions, in guilds and DMs, with their content. MessageContent is
+// privileged, so it has to be turned on for the bot in the developer portal
+// too; without it, guild messages arrive empty unless they mention us.
+const DefaultIntents = GuildMessages | GuildMessageReactions | DirectMessages | DirectMessageReactions | MessageContent
+
+var intentNames = map[string]Intent{
+	"guilds":                        Guilds,
+	"guild_members":                 GuildMembers,
+	"guild_moderation":              GuildModeration,
+	"guild_emojis_and_stickers":     GuildEmojiAndStickers,
+	"guild_integrations":            GuildIntegrations,
+	"guild_webhooks":                GuildWebhooks,
+	"guild_invites":                 GuildInvites,
+	"guild_voice_states":            GuildVoiceStates,
+	"guild_presences":               GuildPresences,
+	"guild_messages":                GuildMessages,
+	"guild_message_reactions":       GuildMessageReactions,
+	"guild_message_typing":          GuildMessageTyping,
+	"direct_messages":               DirectMessages,
+	"direct_message_reactions":      DirectMessageReactions,
+	"direct_message_typing":         DirectMessageTyping,
+	"message_content":               MessageContent,
+	"guild_scheduled_events":        GuildScheduledEvents,
+	"auto_moderation_configuration": AutoModerationConfiguration,
+	"auto_moderation_execution":     AutoModerationExecution,
+}
+
+// ParseIntents turns names like "guild_messages" into intents.
+func ParseIntents(names []string) (Intent, error) {
+	var intents Intent
+
+	for _, name := range names {
+		intent, ok := intentNames[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown intent %q", name)
+		}
+
+		intents |= intent
+	}
+
+	return intents, nil
+}
+
+// Has reports whether i includes all of other.
+func (i Intent) Has(other Intent) bool {
+	return i&other == other
+}
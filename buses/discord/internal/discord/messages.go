@@ -0,0 +1,141 @@
+package discord
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// MaxMessageLength is the most characters Discord takes in a message.
+const MaxMessageLength = 2000
+
+// OutgoingMessage is a message for CreateMessage to post.
+type OutgoingMessage struct {
+	Content     string              `json:"content"`
+	Reference   *MessageReference   `json:"message_reference,omitempty"`
+	Attachments []AttachmentSummary `json:"attachments,omitempty"` // filled in from Files
+
+	Files []File `json:"-"`
+}
+
+// File is a file to upload with a message.
+type File struct {
+	Name    string
+	Content []byte
+}
+
+// AttachmentSummary tells the API about a file uploaded with a message; its
+// id is the file's index in the upload.
+type AttachmentSummary struct {
+	ID       int    `json:"id"`
+	Filename string `json:"filename"`
+}
+
+// MessageReference makes a message a reply to another one.
+type MessageReference struct {
+	MessageID       string `json:"message_id"`
+	FailIfNotExists bool   `json:"fail_if_not_exists"`
+}
+
+// https://discord.com/developers/docs/topics/opcodes-and-status-codes#json-json-error-codes
+const codeThreadAlreadyCreated = 160004
+
+// CreateMessage posts a message to a channel (which might be a thread), and
+// returns it as posted.
+func (c *Client) CreateMessage(ctx context.Context, channelID string, msg OutgoingMessage) (Message, error) {
+	var posted Message
+	endpoint := c.URLFor("/channels/%s/messages", channelID)
+
+	var res *http.Response
+	var err error
+
+	if len(msg.Files) == 0 {
+		res, err = c.Post(ctx, endpoint, msg)
+	} else {
+		msg.Attachments = make([]AttachmentSummary, len(msg.Files))
+		for i, file := range msg.Files {
+			msg.Attachments[i] = AttachmentSummary{ID: i, Filename: file.Name}
+		}
+
+		res, err = c.PostFiles(ctx, endpoint, msg, msg.Files)
+	}
+
+	if err != nil {
+		return posted, err
+	}
+
+	err = readResponse(res, &posted)
+	return posted, err
+}
+
+func (c *Client) EditMessage(ctx context.Context, channelID, messageID, content string) error {
+	endpoint := c.URLFor("/channels/%s/messages/%s", channelID, messageID)
+
+	res, err := c.Patch(ctx, endpoint, map[string]string{"content": content})
+	if err != nil {
+		return err
+	}
+
+	return readResponse(res, nil)
+}
+
+func (c *Client) DeleteMessage(ctx context.Context, channelID, messageID string) error {
+	res, err := c.Delete(ctx, c.URLFor("/channels/%s/messages/%s", channelID, messageID))
+	if err != nil {
+		return err
+	}
+
+	return readResponse(res, nil)
+}
+
+// StartThread starts a thread from a message, and returns the thread's
+// channel id. If the message already has a thread, that's the one we get.
+func (c *Client) StartThread(ctx context.Context, channelID, messageID, name string) (string, error) {
+	endpoint := c.URLFor("/channels/%s/messages/%s/threads", channelID, messageID)
+
+	res, err := c.Post(ctx, endpoint, map[string]string{"name": name})
+	if err != nil {
+		return "", err
+	}
+
+	var thread struct {
+		ID string `json:"id"`
+	}
+
+	err = readResponse(res, &thread)
+
+	// Threads started from messages share their ids.
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.Code == codeThreadAlreadyCreated {
+		return messageID, nil
+	}
+
+	return thread.ID, err
+}
+
+// TriggerTyping shows the typing indicator in a channel, until we send
+// something there or about ten seconds have gone by.
+func (c *Client) TriggerTyping(ctx context.Context, channelID string) error {
+	res, err := c.request(ctx, http.MethodPost, c.URLFor("/channels/%s/typing", channelID), "", nil)
+	if err != nil {
+		return err
+	}
+
+	return readResponse(res, nil)
+}
+
+// React adds a reaction to a message. The emoji is either the emoji itself,
+// or name:id for custom ones.
+func (c *Client) React(ctx context.Context, channelID, messageID, emoji string) error {
+	endpoint := c.URLFor("/channels/%s/messages/%s/reactions/%s/@me",
+		channelID, messageID, url.PathEscape(emoji),
+	)
+
+	res, err := c.Put(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+
+	return readResponse(res, nil)
+}
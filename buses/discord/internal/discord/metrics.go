@@ -0,0 +1,24 @@
+package discord
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Metrics are updated by the client as it runs. The client starts out with
+// a set that aren't registered anywhere; callers who want to export them
+// should replace them with SetMetrics.
+type Metrics struct {
+	HeartbeatLatency prometheus.Observer
+	Reconnects       prometheus.Counter
+	Resumes          prometheus.Counter
+}
+
+func unregisteredMetrics() Metrics {
+	return Metrics{
+		HeartbeatLatency: prometheus.NewHistogram(prometheus.HistogramOpts{Name: "unused"}),
+		Reconnects:       prometheus.NewCounter(prometheus.CounterOpts{Name: "unused"}),
+		Resumes:          prometheus.NewCounter(prometheus.CounterOpts{Name: "unused"}),
+	}
+}
+
+func (c *Client) SetMetrics(m Metrics) {
+	c.metrics = m
+}
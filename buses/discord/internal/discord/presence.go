@@ -0,0 +1,117 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// Presence is the bot's status and activity, as sent in identify and
+// presence updates.
+type Presence struct {
+	Since      *int       `json:"since"` // only for idle
+	Activities []Activity `json:"activities"`
+	Status     string     `json:"status"`
+	AFK        bool       `json:"afk"`
+}
+
+type Activity struct {
+	Name  string       `json:"name"`
+	Type  ActivityType `json:"type"`
+	State string       `json:"state,omitempty"` // custom status text
+}
+
+type ActivityType int
+
+// https://discord.com/developers/docs/topics/gateway-events#activity-object-activity-types
+const (
+	ActivityPlaying ActivityType = iota
+	ActivityStreaming
+	ActivityListening
+	ActivityWatching
+	ActivityCustom
+	ActivityCompeting
+)
+
+var activityTypes = map[string]ActivityType{
+	"playing":   ActivityPlaying,
+	"streaming": ActivityStreaming,
+	"listening": ActivityListening,
+	"watching":  ActivityWatching,
+	"custom":    ActivityCustom,
+	"competing": ActivityCompeting,
+}
+
+var statuses = []string{"online", "idle", "dnd", "invisible"}
+
+// NewPresence makes a presence from the names people write in config files.
+// An empty status means online, and an empty activity means none.
+func NewPresence(status, activity, text string) (Presence, error) {
+	p := Presence{Status: status, Activities: []Activity{}}
+
+	if p.Status == "" {
+		p.Status = "online"
+	}
+
+	if !slices.Contains(statuses, p.Status) {
+		return p, fmt.Errorf("unknown status %q", status)
+	}
+
+	if activity == "" {
+		return p, nil
+	}
+
+	typ, ok := activityTypes[activity]
+	if !ok {
+		return p, fmt.Errorf("unknown activity type %q", activity)
+	}
+
+	if text == "" {
+		return p, fmt.Errorf("%s activity has no text", activity)
+	}
+
+	// Custom statuses show their state, and need a name that's ignored.
+	act := Activity{Name: text, Type: typ}
+	if typ == ActivityCustom {
+		act = Activity{Name: "Custom Status", Type: typ, State: text}
+	}
+
+	p.Activities = append(p.Activities, act)
+	return p, nil
+}
+
+// SetPresence sets the presence to identify with, and updates it on every
+// shard that's already connected. It doesn't block, and is safe to call from
+// any goroutine.
+func (c *Client) SetPresence(p Presence) {
+	c.mu.Lock()
+	c.presence = p
+	shards := c.shards
+	c.mu.Unlock()
+
+	for _, s := range shards {
+		select {
+		case s.presenceChanged <- struct{}{}:
+		default:
+			// already pending
+		}
+	}
+}
+
+func (c *Client) currentPresence() Presence {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.presence
+}
+
+func (s *shard) sendPresence(ctx context.Context, cn *conn) error {
+	data, _ := json.Marshal(arbitraryJSON{
+		"op": PresenceUpdate,
+		"d":  s.client.currentPresence(),
+	})
+
+	s.logger.Debug("will update presence")
+	return s.write(ctx, cn, data)
+}
@@ -0,0 +1,439 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// shard is a single gateway connection, which gets the events for some
+// slice of the bot's guilds. Everything about the connection is owned by the
+// goroutine running it; other goroutines only see what's in health, behind
+// its lock.
+type shard struct {
+	client *Client
+	id     int
+	count  int
+	logger *slog.Logger
+
+	ws      *websocket.Conn
+	session session
+	health  health
+	userID  string // ours, from READY
+
+	presenceChanged chan struct{} // poked by SetPresence
+}
+
+// session is what we need to resume a session on a new connection.
+type session struct {
+	id        string
+	resumeURL string
+	seq       *int
+}
+
+// conn is the state of a single gateway connection.
+type conn struct {
+	ws       *websocket.Conn
+	state    connState
+	interval time.Duration
+	beat     *time.Timer
+	acked    bool
+	lastBeat time.Time
+}
+
+// outcome is how a connection ended: the state to move to next, and why.
+type outcome struct {
+	next connState
+	err  error
+}
+
+func newShard(c *Client, id, count int) *shard {
+	return &shard{
+		client: c,
+		id:     id,
+		count:  count,
+		logger: c.logger.With("shard", id),
+
+		presenceChanged: make(chan struct{}, 1),
+	}
+}
+
+func (s *shard) dial(ctx context.Context, base string) error {
+	url, err := s.client.connectURL(base)
+	if err != nil {
+		return err
+	}
+
+	dctx, cancel := reconnectContext(ctx)
+	defer cancel()
+
+	ws, _, err := websocket.Dial(dctx, url, nil)
+	if err != nil {
+		return fmt.Errorf("could not connect to websocket: %w", err)
+	}
+
+	s.ws = ws
+	return nil
+}
+
+func reconnectContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, 15*time.Second)
+}
+
+var errFrameNotText = errors.New("got binary websocket type")
+
+// errReshard is what a shard stops with when Discord closes it because
+// we're running the wrong number of shards. It's up to the client to start
+// them all over.
+var errReshard = errors.New("discord wants a different number of shards")
+
+// run runs the shard's connection, which must already be dialed, until ctx
+// is cancelled or something goes irrecoverably wrong, in which case it
+// returns why. If Discord wants a different number of shards, that's
+// errReshard, which is the end of this shard but not of the client. Messages are sent to dataCh, and non-fatal errors to errCh.
+func (s *shard) run(ctx context.Context, dataCh chan<- Incoming, errCh chan<- error) error {
+	state := stateIdentifying
+
+	for {
+		out := s.runConn(ctx, state, dataCh, errCh)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if errors.Is(out.err, errReshard) {
+			s.health.setState(stateReconnecting)
+			return out.err
+		}
+
+		if out.next == stateDead {
+			s.health.setState(stateDead)
+			return out.err
+		}
+
+		if out.err != nil {
+			report(ctx, errCh, out.err)
+		}
+
+		var err error
+		state, err = s.redial(ctx, out.next)
+		if err != nil {
+			s.health.setState(stateDead)
+			return err
+		}
+	}
+}
+
+// redial makes a new connection after losing the last one, and returns the
+// state the new connection starts in. If we can't resume, we start over.
+func (s *shard) redial(ctx context.Context, next connState) (connState, error) {
+	if next == stateResuming && s.session.id != "" {
+		s.health.setState(stateResuming)
+		s.logger.Info("resuming websocket connection")
+		s.client.metrics.Resumes.Inc()
+
+		err := s.dial(ctx, s.session.resumeURL)
+		if err == nil {
+			return stateResuming, nil
+		}
+
+		s.logger.Warn("could not resume; starting a new session", "err", err)
+	}
+
+	s.health.setState(stateReconnecting)
+	s.logger.Info("reconnecting websocket connection")
+	s.client.metrics.Reconnects.Inc()
+	s.session = session{}
+
+	if err := s.dial(ctx, s.client.gatewayURL); err != nil {
+		return stateDead, err
+	}
+
+	return stateIdentifying, nil
+}
+
+type frameOrErr struct {
+	data []byte
+	err  error
+}
+
+// runConn runs a single connection, starting in the given state (identifying
+// or resuming), until it's over.
+func (s *shard) runConn(ctx context.Context, state connState, dataCh chan<- Incoming, errCh chan<- error) (out outcome) {
+	cn := &conn{ws: s.ws, state: state, acked: true}
+	s.health.setState(state)
+
+	// The reader gets its own context: cancelling a read closes the
+	// connection, and we want to close it ourselves, with the right code.
+	readCtx, cancelRead := context.WithCancel(context.Background())
+	frames := make(chan frameOrErr)
+	readerDone := make(chan struct{})
+
+	read := readFrames
+	if s.client.compress {
+		read = readCompressed
+	}
+
+	go func() {
+		defer close(readerDone)
+		read(readCtx, cn.ws, frames)
+	}()
+
+	defer func() {
+		if cn.beat != nil {
+			cn.beat.Stop()
+		}
+
+		// Closing with a normal status code ends the session, so only do
+		// that if we're shutting down.
+		if ctx.Err() != nil {
+			cn.ws.Close(websocket.StatusNormalClosure, "so long")
+		} else {
+			cn.ws.Close(websocket.StatusCode(4000), out.next.String())
+		}
+
+		cancelRead()
+		<-readerDone
+	}()
+
+	for {
+		var beat <-chan time.Time
+		if cn.beat != nil {
+			beat = cn.beat.C
+		}
+
+		// Presence updates have to wait until we're ready; identify sends
+		// whatever's current, anyway.
+		var presence <-chan struct{}
+		if cn.state == stateReady {
+			presence = s.presenceChanged
+		}
+
+		select {
+		case <-ctx.Done():
+			return outcome{}
+
+		case <-beat:
+			if !cn.acked {
+				return outcome{stateResuming, errors.New("failed to receive ack for last heartbeat")}
+			}
+
+			if err := s.sendHeartbeat(ctx, cn); err != nil {
+				return outcome{stateResuming, err}
+			}
+
+			cn.beat.Reset(cn.interval)
+
+		case <-presence:
+			if err := s.sendPresence(ctx, cn); err != nil {
+				return outcome{stateResuming, err}
+			}
+
+		case frame := <-frames:
+			if errors.Is(frame.err, errFrameNotText) {
+				report(ctx, errCh, frame.err)
+				continue
+			}
+
+			if frame.err != nil {
+				return readOutcome(frame.err)
+			}
+
+			msg, end, err := s.handleFrame(ctx, cn, frame.data)
+			if end != nil {
+				return *end
+			}
+
+			if err != nil {
+				report(ctx, errCh, err)
+			}
+
+			if msg != nil {
+				select {
+				case dataCh <- msg:
+				case <-ctx.Done():
+					return outcome{}
+				}
+			}
+		}
+	}
+}
+
+func readFrames(ctx context.Context, ws *websocket.Conn, frames chan<- frameOrErr) {
+	for {
+		typ, data, err := ws.Read(ctx)
+
+		var frame frameOrErr
+		switch {
+		case err != nil:
+			frame.err = err
+		case typ != websocket.MessageText:
+			frame.err = errFrameNotText
+		default:
+			frame.data = data
+		}
+
+		select {
+		case frames <- frame:
+		case <-ctx.Done():
+			return
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func readOutcome(err error) outcome {
+	var closeErr websocket.CloseError
+	if errors.As(err, &closeErr) {
+		switch closeErr.Code {
+		case DisallowedIntent:
+			return outcome{stateDead, fmt.Errorf("not allowed the intents we asked for; privileged ones like message_content have to be enabled in the developer portal: %w", err)}
+
+		case InvalidShard, ShardingRequired:
+			return outcome{stateReconnecting, fmt.Errorf("%w: %w", errReshard, err)}
+
+		case AuthenticationFailed, InvalidAPIVersion, InvalidIntent:
+			return outcome{stateDead, fmt.Errorf("ws read error: %w", err)}
+
+		case InvalidSeq, SessionTimedOut:
+			return outcome{stateReconnecting, err}
+		}
+	}
+
+	return outcome{stateResuming, fmt.Errorf("ws read error: %w", err)}
+}
+
+// handleFrame handles a single frame from the gateway. If the frame ends the
+// connection, it returns how; otherwise it may return a message to pass on,
+// or a non-fatal error.
+func (s *shard) handleFrame(ctx context.Context, cn *conn, data []byte) (Incoming, *outcome, error) {
+	var event GatewayEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, nil, fmt.Errorf("bad frame from discord: %w", err)
+	}
+
+	if event.Seq != nil {
+		s.session.seq = event.Seq
+	}
+
+	switch event.Op {
+	case Hello:
+		if err := s.doHello(ctx, cn, event); err != nil {
+			return nil, &outcome{stateResuming, err}, nil
+		}
+
+		return nil, nil, nil
+
+	case Heartbeat:
+		if err := s.sendHeartbeat(ctx, cn); err != nil {
+			return nil, &outcome{stateResuming, err}, nil
+		}
+
+		return nil, nil, nil
+
+	case HeartbeatACK:
+		s.ackHeartbeat(cn)
+		return nil, nil, nil
+
+	case Reconnect:
+		return nil, &outcome{next: stateResuming}, nil
+
+	case InvalidSession:
+		var canResume bool
+		if err := json.Unmarshal(event.Data, &canResume); err != nil {
+			return nil, nil, fmt.Errorf("got an InvalidSession op with bad data: %s", event.Data)
+		}
+
+		if canResume {
+			return nil, &outcome{next: stateResuming}, nil
+		}
+
+		return nil, &outcome{next: stateReconnecting}, nil
+
+	case Dispatch:
+		msg, err := s.dispatch(cn, &event)
+		return msg, nil, err
+
+	default:
+		s.logger.Debug("ignoring gateway event", "type", event.Op)
+		return nil, nil, nil
+	}
+}
+
+func (s *shard) dispatch(cn *conn, evt *GatewayEvent) (Incoming, error) {
+	switch evt.Type {
+	case TypeReady:
+		return nil, s.handleReady(cn, evt)
+
+	case TypeMessageCreate:
+		return s.handleMessage(evt)
+
+	case TypeMessageUpdate:
+		return s.handleEdit(evt)
+
+	case TypeMessageDelete:
+		return s.handleDelete(evt)
+
+	case TypeReactionAdd:
+		return s.handleReaction(evt)
+
+	case TypeResumed:
+		s.logger.Debug("finished resuming")
+		s.setConnState(cn, stateReady)
+		return nil, nil
+
+	default:
+		s.logger.Debug("ignoring dispatch event", "type", evt.Type)
+	}
+
+	return nil, nil
+}
+
+func (s *shard) setConnState(cn *conn, state connState) {
+	cn.state = state
+	s.health.setState(state)
+}
+
+// heartbeatJitter is how far into the first interval we send the first
+// heartbeat, as Discord asks; it's a variable so that tests can pin it.
+var heartbeatJitter = rand.Float64
+
+func (s *shard) startHeartbeats(cn *conn, interval time.Duration) {
+	first := time.Duration(float64(interval) * heartbeatJitter())
+	s.logger.Debug("waiting to send first heartbeat", "interval", first)
+
+	cn.interval = interval
+	cn.acked = true
+
+	if cn.beat != nil {
+		cn.beat.Stop()
+	}
+
+	cn.beat = time.NewTimer(first)
+}
+
+func report(ctx context.Context, errCh chan<- error, err error) {
+	select {
+	case errCh <- err:
+	case <-ctx.Done():
+	}
+}
+
+func (s *shard) write(ctx context.Context, cn *conn, data []byte) error {
+	writeCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	if err := cn.ws.Write(writeCtx, websocket.MessageText, data); err != nil {
+		return fmt.Errorf("bad websocket write: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package discord
+
+// connState is where a shard is in the life of its gateway connection.
+//
+//	connecting ──▶ identifying ──▶ ready
+//	                   ▲             │
+//	                   │             ▼
+//	              reconnecting ◀── resuming
+//
+// Anything can go to dead, from which there's no coming back.
+type connState int32
+
+const (
+	// Dialing the gateway for the first time.
+	stateConnecting connState = iota
+	// Connected, and identifying to start a new session; waiting for READY.
+	stateIdentifying
+	// Connected, with a session; events are flowing.
+	stateReady
+	// Lost the connection, and trying to pick the session back up where we
+	// left off; waiting for RESUMED.
+	stateResuming
+	// Lost the session, and dialing the gateway to start over.
+	stateReconnecting
+	// Gave up; Err says why.
+	stateDead
+)
+
+func (s connState) String() string {
+	switch s {
+	case stateConnecting:
+		return "connecting"
+	case stateIdentifying:
+		return "identifying"
+	case stateReady:
+		return "ready"
+	case stateResuming:
+		return "resuming"
+	case stateReconnecting:
+		return "reconnecting"
+	case stateDead:
+		return "dead"
+	default:
+		return "unknown"
+	}
+}
@@ -2,25 +2,107 @@ package discord
 
 // incomplete, obviously
 type Message struct {
-	ID        string
-	Author    User
-	Content   string
-	ChannelID string `mapstructure:"channel_id"`
-	Mentions  []User
+	ID        string `json:"id"`
+	Author    User   `json:"author"`
+	Content   string `json:"content"`
+	ChannelID string `json:"channel_id"`
+	GuildID   string `json:"guild_id"` // empty for direct messages
+	Mentions  []User `json:"mentions"`
+	Member    Member `json:"member"` // only for messages in guilds
+
+	Attachments  []Attachment  `json:"attachments"`
+	Embeds       []Embed       `json:"embeds"`
+	StickerItems []StickerItem `json:"sticker_items"`
+
+	EditedTimestamp string `json:"edited_timestamp"` // empty unless edited
+}
+
+// empty reports whether there's nothing in a message at all.
+func (m *Message) empty() bool {
+	return m.Content == "" && len(m.Attachments) == 0 && len(m.Embeds) == 0 && len(m.StickerItems) == 0
+}
+
+type Attachment struct {
+	ID       string `json:"id"`
+	Filename string `json:"filename"`
+	URL      string `json:"url"`
+}
+
+type Embed struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+type StickerItem struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// MessageEdit is a message that's been edited, as it is now.
+type MessageEdit struct {
+	Message
+}
+
+// MessageDelete is all we get to know about a deleted message.
+type MessageDelete struct {
+	ID        string `json:"id"`
+	ChannelID string `json:"channel_id"`
+	GuildID   string `json:"guild_id"`
+}
+
+type Member struct {
+	User  *User    `json:"user"`  // only in reactions
+	Roles []string `json:"roles"` // role ids
+}
+
+// Reaction is someone reacting to a message.
+type Reaction struct {
+	UserID    string `json:"user_id"`
+	ChannelID string `json:"channel_id"`
+	MessageID string `json:"message_id"`
+	GuildID   string `json:"guild_id"` // empty for direct messages
+	Member    Member `json:"member"`   // only for reactions in guilds
+	Emoji     Emoji  `json:"emoji"`
+}
+
+type Emoji struct {
+	ID   string `json:"id"` // empty for unicode emoji
+	Name string `json:"name"`
 }
 
+// String returns the emoji the way the API wants it in URLs: the emoji
+// itself, or name:id for custom ones.
+func (e Emoji) String() string {
+	if e.ID == "" {
+		return e.Name
+	}
+
+	return e.Name + ":" + e.ID
+}
+
+// Incoming is something from the gateway for the client's caller to
+// handle: a *Message, *MessageEdit, *MessageDelete, or *Reaction.
+type Incoming interface {
+	incoming()
+}
+
+func (*Message) incoming()       {}
+func (*MessageEdit) incoming()   {}
+func (*MessageDelete) incoming() {}
+func (*Reaction) incoming()      {}
+
 type User struct {
-	ID            string
-	Username      string
-	Discriminator string
-	IsBot         bool `mapstructure:"bot"`
+	ID            string `json:"id"`
+	Username      string `json:"username"`
+	Discriminator string `json:"discriminator"`
+	IsBot         bool   `json:"bot"`
 }
 
 type Ready struct {
-	APIVersion       int `mapstructure:"v"`
-	User             User
-	SessionID        string `mapstructure:"session_id"`
-	ResumeGatewayURL string `mapstructure:"resume_gateway_url"`
+	APIVersion       int    `json:"v"`
+	User             User   `json:"user"`
+	SessionID        string `json:"session_id"`
+	ResumeGatewayURL string `json:"resume_gateway_url"`
 
 	// ignoring, for now: guilds, application
 }
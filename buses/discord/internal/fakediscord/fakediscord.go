@@ -0,0 +1,736 @@
+// Package fakediscord is an in-process Discord, for testing: a websocket
+// gateway that tests drive by hand, and just enough of the REST API for
+// marvin to find the gateway and post messages.
+//
+// A test starts a Server, points a client at it, and then scripts each
+// gateway connection:
+//
+//	srv := fakediscord.NewServer(t)
+//	// ... connect a client to srv.APIBase or srv.GatewayURL ...
+//
+//	conn := srv.NextConn()
+//	conn.SendHello(time.Second)
+//	conn.Expect(fakediscord.OpIdentify)
+//	conn.SendReady("session-id")
+package fakediscord
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"nhooyr.io/websocket"
+)
+
+// Timeout is how long the Expect methods wait for something to happen.
+var Timeout = 5 * time.Second
+
+// Gateway opcodes, from
+// https://discord.com/developers/docs/topics/opcodes-and-status-codes
+const (
+	OpDispatch       = 0
+	OpHeartbeat      = 1
+	OpIdentify       = 2
+	OpPresenceUpdate = 3
+	OpResume         = 6
+	OpReconnect      = 7
+	OpInvalidSession = 9
+	OpHello          = 10
+	OpHeartbeatACK   = 11
+)
+
+// A Frame is a single gateway message, in either direction.
+type Frame struct {
+	Op   int             `json:"op"`
+	Data json.RawMessage `json:"d"`
+	Seq  *int            `json:"s,omitempty"`
+	Type string          `json:"t,omitempty"`
+}
+
+// Decode unmarshals the frame's data into v, failing the test if it can't.
+func (f Frame) Decode(t testing.TB, v any) {
+	t.Helper()
+
+	if err := json.Unmarshal(f.Data, v); err != nil {
+		t.Fatalf("could not decode op %d data %s: %s", f.Op, f.Data, err)
+	}
+}
+
+// A PostedMessage is a message sent to the REST API.
+type PostedMessage struct {
+	ChannelID     string
+	Authorization string
+	Body          map[string]any
+	Files         map[string]string // uploaded file contents, by name
+}
+
+// A PostedReaction is a reaction added through the REST API.
+type PostedReaction struct {
+	ChannelID string
+	MessageID string
+	Emoji     string
+}
+
+// An APICall is a call to the REST API to start a thread, edit or delete a
+// message, or show the typing indicator.
+type APICall struct {
+	Method    string
+	ChannelID string
+	MessageID string
+	Body      map[string]any
+}
+
+type Server struct {
+	// APIBase is the REST API's base URL, which clients should use in place
+	// of https://discord.com/api/v10.
+	APIBase string
+
+	// GatewayURL is the websocket URL of the gateway. It's also what
+	// GET /gateway returns, and the resume URL that SendReady sends.
+	GatewayURL string
+
+	// Shards and MaxConcurrency are what GET /gateway/bot recommends. Set
+	// them before connecting a client; they both default to 1.
+	Shards         int
+	MaxConcurrency int
+
+	t     testing.TB
+	http  *httptest.Server
+	conns chan *Conn
+
+	mu        sync.Mutex
+	open      []*Conn
+	messages  []PostedMessage
+	posted    chan PostedMessage
+	reactions chan PostedReaction
+	calls     chan APICall
+	threads   map[string]bool // by starting message id
+}
+
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	s := &Server{
+		Shards:         1,
+		MaxConcurrency: 1,
+
+		t:         t,
+		conns:     make(chan *Conn, 16),
+		posted:    make(chan PostedMessage, 64),
+		reactions: make(chan PostedReaction, 64),
+		calls:     make(chan APICall, 64),
+		threads:   make(map[string]bool),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/gateway-ws", s.handleGateway)
+	mux.HandleFunc("/api/v10/gateway", s.handleGetGateway)
+	mux.HandleFunc("/api/v10/gateway/bot", s.handleGetGatewayBot)
+	mux.HandleFunc("/api/v10/channels/", s.handleChannel)
+
+	s.http = httptest.NewServer(mux)
+	s.APIBase = s.http.URL + "/api/v10"
+	s.GatewayURL = "ws" + strings.TrimPrefix(s.http.URL, "http") + "/gateway-ws"
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// Close shuts down the server, and any open gateway connections.
+func (s *Server) Close() {
+	s.mu.Lock()
+	open := s.open
+	s.open = nil
+	s.mu.Unlock()
+
+	for _, conn := range open {
+		_ = conn.ws.Close(websocket.StatusGoingAway, "fake discord shutting down")
+	}
+
+	s.http.Close()
+}
+
+// NextConn waits for a client to connect to the gateway, failing the test if
+// nobody does.
+func (s *Server) NextConn() *Conn {
+	s.t.Helper()
+
+	select {
+	case conn := <-s.conns:
+		return conn
+	case <-time.After(Timeout):
+		s.t.Fatal("timed out waiting for a gateway connection")
+		return nil
+	}
+}
+
+// ExpectNoConn fails the test if a client connects to the gateway within
+// wait.
+func (s *Server) ExpectNoConn(wait time.Duration) {
+	s.t.Helper()
+
+	select {
+	case <-s.conns:
+		s.t.Fatal("got an unexpected gateway connection")
+	case <-time.After(wait):
+	}
+}
+
+// ExpectPost waits for a message to be posted to the REST API.
+func (s *Server) ExpectPost() PostedMessage {
+	s.t.Helper()
+
+	select {
+	case msg := <-s.posted:
+		return msg
+	case <-time.After(Timeout):
+		s.t.Fatal("timed out waiting for a posted message")
+		return PostedMessage{}
+	}
+}
+
+// ExpectReaction waits for a reaction to be added through the REST API.
+func (s *Server) ExpectReaction() PostedReaction {
+	s.t.Helper()
+
+	select {
+	case reaction := <-s.reactions:
+		return reaction
+	case <-time.After(Timeout):
+		s.t.Fatal("timed out waiting for a reaction")
+		return PostedReaction{}
+	}
+}
+
+// ExpectCall waits for a thread to be started, a message to be edited or
+// deleted, or the typing indicator to be shown, through the REST API.
+func (s *Server) ExpectCall() APICall {
+	s.t.Helper()
+
+	select {
+	case call := <-s.calls:
+		return call
+	case <-time.After(Timeout):
+		s.t.Fatal("timed out waiting for an api call")
+		return APICall{}
+	}
+}
+
+// Messages returns everything posted to the REST API so far.
+func (s *Server) Messages() []PostedMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]PostedMessage(nil), s.messages...)
+}
+
+func (s *Server) handleGetGateway(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"url": s.GatewayURL})
+}
+
+func (s *Server) handleGetGatewayBot(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bot ") {
+		http.Error(w, `{"message": "401: Unauthorized", "code": 0}`, http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"url":    s.GatewayURL,
+		"shards": s.Shards,
+		"session_start_limit": map[string]any{
+			"total":           1000,
+			"remaining":       1000,
+			"reset_after":     0,
+			"max_concurrency": s.MaxConcurrency,
+		},
+	})
+}
+
+func (s *Server) handleChannel(w http.ResponseWriter, r *http.Request) {
+	channel, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/v10/channels/"), "/")
+	parts := strings.Split(rest, "/")
+
+	switch {
+	// messages/{message}/reactions/{emoji}/@me
+	case len(parts) == 5 && parts[2] == "reactions" && parts[4] == "@me":
+		s.handleReaction(w, r, channel, parts[1], parts[3])
+
+	// messages/{message}/threads
+	case len(parts) == 3 && parts[0] == "messages" && parts[2] == "threads" && r.Method == http.MethodPost:
+		s.handleThread(w, r, channel, parts[1])
+
+	// messages/{message}
+	case len(parts) == 2 && parts[0] == "messages" && (r.Method == http.MethodPatch || r.Method == http.MethodDelete):
+		s.handleMessageChange(w, r, channel, parts[1])
+
+	case rest == "messages" && r.Method == http.MethodPost:
+		s.handlePost(w, r, channel)
+
+	case rest == "typing" && r.Method == http.MethodPost:
+		s.recordCall(APICall{Method: r.Method, ChannelID: channel})
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, `{"message": "404: Not Found", "code": 0}`, http.StatusNotFound)
+	}
+}
+
+func (s *Server) handlePost(w http.ResponseWriter, r *http.Request, channel string) {
+	body, files, err := readPost(r)
+	if err != nil {
+		http.Error(w, `{"message": "Cannot send an empty message", "code": 50006}`, http.StatusBadRequest)
+		return
+	}
+
+	if content, _ := body["content"].(string); utf8.RuneCountInString(content) > 2000 {
+		http.Error(w, `{"message": "Invalid Form Body", "code": 50035}`, http.StatusBadRequest)
+		return
+	}
+
+	msg := PostedMessage{
+		ChannelID:     channel,
+		Authorization: r.Header.Get("Authorization"),
+		Body:          body,
+		Files:         files,
+	}
+
+	s.mu.Lock()
+	s.messages = append(s.messages, msg)
+	id := len(s.messages)
+	s.mu.Unlock()
+
+	select {
+	case s.posted <- msg:
+	default:
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"id":         fmt.Sprint(id),
+		"channel_id": channel,
+		"content":    body["content"],
+	})
+}
+
+// readPost reads a message's body, which is either JSON or, if it comes
+// with files, multipart form data with the JSON in payload_json.
+func readPost(r *http.Request) (map[string]any, map[string]string, error) {
+	var body map[string]any
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		err := json.NewDecoder(r.Body).Decode(&body)
+		return body, nil, err
+	}
+
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		return nil, nil, err
+	}
+
+	if err := json.Unmarshal([]byte(r.FormValue("payload_json")), &body); err != nil {
+		return nil, nil, err
+	}
+
+	files := make(map[string]string)
+
+	for _, headers := range r.MultipartForm.File {
+		for _, header := range headers {
+			f, err := header.Open()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			data, err := io.ReadAll(f)
+			f.Close()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			files[header.Filename] = string(data)
+		}
+	}
+
+	return body, files, nil
+}
+
+// handleThread starts a thread from a message, which gets the message's id,
+// unless there's already one there.
+func (s *Server) handleThread(w http.ResponseWriter, r *http.Request, channel, message string) {
+	var body map[string]any
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	s.mu.Lock()
+	exists := s.threads[message]
+	s.threads[message] = true
+	s.mu.Unlock()
+
+	if exists {
+		http.Error(w, `{"message": "A thread has already been created for this message", "code": 160004}`, http.StatusBadRequest)
+		return
+	}
+
+	s.recordCall(APICall{Method: r.Method, ChannelID: channel, MessageID: message, Body: body})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"id":        message,
+		"parent_id": channel,
+		"name":      body["name"],
+		"type":      11,
+	})
+}
+
+// handleMessageChange edits or deletes a message, which always works, since
+// we don't keep track of what's there.
+func (s *Server) handleMessageChange(w http.ResponseWriter, r *http.Request, channel, message string) {
+	var body map[string]any
+	if r.Method == http.MethodPatch {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+	}
+
+	s.recordCall(APICall{Method: r.Method, ChannelID: channel, MessageID: message, Body: body})
+
+	if r.Method == http.MethodDelete {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"id":         message,
+		"channel_id": channel,
+		"content":    body["content"],
+	})
+}
+
+func (s *Server) recordCall(call APICall) {
+	select {
+	case s.calls <- call:
+	default:
+	}
+}
+
+func (s *Server) handleReaction(w http.ResponseWriter, r *http.Request, channel, message, emoji string) {
+	if r.Method != http.MethodPut {
+		http.Error(w, `{"message": "405: Method Not Allowed", "code": 0}`, http.StatusMethodNotAllowed)
+		return
+	}
+
+	// The path's already been unescaped by now, so the emoji is as-is.
+	select {
+	case s.reactions <- PostedReaction{ChannelID: channel, MessageID: message, Emoji: emoji}:
+	default:
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleGateway(w http.ResponseWriter, r *http.Request) {
+	ws, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		s.t.Errorf("could not accept gateway connection: %s", err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	conn := &Conn{
+		Query:  r.URL.Query(),
+		t:      s.t,
+		srv:    s,
+		ws:     ws,
+		ctx:    ctx,
+		frames: make(chan Frame, 256),
+		closed: make(chan struct{}),
+	}
+
+	if conn.Query.Get("compress") == "zlib-stream" {
+		conn.zw = zlib.NewWriter(&conn.zbuf)
+	}
+
+	s.mu.Lock()
+	s.open = append(s.open, conn)
+	s.mu.Unlock()
+
+	s.conns <- conn
+
+	// The handler has to stick around for as long as the connection does.
+	conn.readLoop()
+	cancel()
+}
+
+// Conn is a single client connection to the gateway.
+type Conn struct {
+	// Query is the query string the client connected with. If it asked
+	// for compress=zlib-stream, everything we send is compressed.
+	Query url.Values
+
+	t   testing.TB
+	srv *Server
+	ws  *websocket.Conn
+	ctx context.Context
+
+	frames      chan Frame
+	closed      chan struct{} // closed when the client goes away
+	closeStatus websocket.StatusCode
+
+	mu   sync.Mutex
+	seq  int
+	zw   *zlib.Writer // nil if we're not compressing
+	zbuf bytes.Buffer
+}
+
+func (c *Conn) readLoop() {
+	defer close(c.closed)
+
+	for {
+		_, data, err := c.ws.Read(c.ctx)
+		if err != nil {
+			c.closeStatus = websocket.CloseStatus(err)
+			return
+		}
+
+		var frame Frame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			c.t.Errorf("client sent a bad frame %q: %s", data, err)
+			continue
+		}
+
+		c.frames <- frame
+	}
+}
+
+// Send sends a frame to the client. For dispatch frames, the sequence number
+// is filled in automatically.
+func (c *Conn) Send(frame Frame) {
+	c.t.Helper()
+
+	if frame.Op == OpDispatch && frame.Seq == nil {
+		c.mu.Lock()
+		c.seq++
+		seq := c.seq
+		c.mu.Unlock()
+
+		frame.Seq = &seq
+	}
+
+	if frame.Data == nil {
+		frame.Data = json.RawMessage("null")
+	}
+
+	data, err := json.Marshal(frame)
+	if err != nil {
+		c.t.Fatalf("could not encode frame: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, Timeout)
+	defer cancel()
+
+	// The compressed stream has to go out in the order we wrote it, so hold
+	// the lock until it has.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	typ := websocket.MessageText
+	if c.zw != nil {
+		typ = websocket.MessageBinary
+		data = c.compress(data)
+	}
+
+	if err := c.ws.Write(ctx, typ, data); err != nil {
+		c.t.Errorf("could not send op %d: %s", frame.Op, err)
+	}
+}
+
+// compress adds data to the connection's zlib stream, and returns the
+// compressed bytes, ending with the flush Discord sends after each payload.
+// The caller must hold c.mu.
+func (c *Conn) compress(data []byte) []byte {
+	c.t.Helper()
+
+	c.zbuf.Reset()
+
+	if _, err := c.zw.Write(data); err != nil {
+		c.t.Fatalf("could not compress frame: %s", err)
+	}
+
+	if err := c.zw.Flush(); err != nil {
+		c.t.Fatalf("could not compress frame: %s", err)
+	}
+
+	return bytes.Clone(c.zbuf.Bytes())
+}
+
+// SendOp sends a frame with the given op and data, which is encoded as JSON.
+func (c *Conn) SendOp(op int, data any) {
+	c.t.Helper()
+	c.Send(Frame{Op: op, Data: c.encode(data)})
+}
+
+// Dispatch sends a dispatch (op 0) event of the given type.
+func (c *Conn) Dispatch(typ string, data any) {
+	c.t.Helper()
+	c.Send(Frame{Op: OpDispatch, Type: typ, Data: c.encode(data)})
+}
+
+func (c *Conn) SendHello(interval time.Duration) {
+	c.t.Helper()
+	c.SendOp(OpHello, map[string]any{"heartbeat_interval": interval.Milliseconds()})
+}
+
+func (c *Conn) SendHeartbeatACK() {
+	c.t.Helper()
+	c.SendOp(OpHeartbeatACK, nil)
+}
+
+// SendReady sends READY, with the server's gateway as the resume URL.
+func (c *Conn) SendReady(sessionID string) {
+	c.t.Helper()
+	c.Dispatch("READY", map[string]any{
+		"v":                  10,
+		"session_id":         sessionID,
+		"resume_gateway_url": c.srv.GatewayURL,
+		"user":               map[string]any{"id": "1", "username": "marvin", "bot": true},
+	})
+}
+
+// SendMessageCreate dispatches a MESSAGE_CREATE for a guild message.
+func (c *Conn) SendMessageCreate(channelID, username, content string) {
+	c.t.Helper()
+	c.Dispatch("MESSAGE_CREATE", map[string]any{
+		"id":         "100",
+		"channel_id": channelID,
+		"guild_id":   "10",
+		"content":    content,
+		"author":     map[string]any{"id": "2", "username": username},
+	})
+}
+
+// SendMessageUpdate dispatches a MESSAGE_UPDATE for an edited guild message.
+func (c *Conn) SendMessageUpdate(channelID, messageID, username, content string) {
+	c.t.Helper()
+	c.Dispatch("MESSAGE_UPDATE", map[string]any{
+		"id":               messageID,
+		"channel_id":       channelID,
+		"guild_id":         "10",
+		"content":          content,
+		"edited_timestamp": time.Now().Format(time.RFC3339),
+		"author":           map[string]any{"id": "2", "username": username},
+	})
+}
+
+// SendMessageDelete dispatches a MESSAGE_DELETE for a guild message.
+func (c *Conn) SendMessageDelete(channelID, messageID string) {
+	c.t.Helper()
+	c.Dispatch("MESSAGE_DELETE", map[string]any{
+		"id":         messageID,
+		"channel_id": channelID,
+		"guild_id":   "10",
+	})
+}
+
+// SendReactionAdd dispatches a MESSAGE_REACTION_ADD for a guild message.
+func (c *Conn) SendReactionAdd(channelID, messageID, userID, username, emoji string) {
+	c.t.Helper()
+	c.Dispatch("MESSAGE_REACTION_ADD", map[string]any{
+		"user_id":    userID,
+		"channel_id": channelID,
+		"message_id": messageID,
+		"guild_id":   "10",
+		"member": map[string]any{
+			"user":  map[string]any{"id": userID, "username": username},
+			"roles": []string{},
+		},
+		"emoji": map[string]any{"id": nil, "name": emoji},
+	})
+}
+
+func (c *Conn) SendReconnect() {
+	c.t.Helper()
+	c.SendOp(OpReconnect, nil)
+}
+
+func (c *Conn) SendInvalidSession(resumable bool) {
+	c.t.Helper()
+	c.SendOp(OpInvalidSession, resumable)
+}
+
+// Close closes the connection from the server's end, with a gateway close
+// code (like 4000 for "unknown error").
+func (c *Conn) Close(code int, reason string) {
+	_ = c.ws.Close(websocket.StatusCode(code), reason)
+}
+
+// Next returns the next frame the client sends.
+func (c *Conn) Next() Frame {
+	c.t.Helper()
+
+	select {
+	case frame := <-c.frames:
+		return frame
+	case <-time.After(Timeout):
+		c.t.Fatal("timed out waiting for a frame from the client")
+		return Frame{}
+	}
+}
+
+// Expect returns the next frame the client sends with the given op,
+// skipping over heartbeats (unless that's what we're expecting), which
+// arrive whenever the client feels like it. Any other op fails the test.
+func (c *Conn) Expect(op int) Frame {
+	c.t.Helper()
+
+	for {
+		frame := c.Next()
+
+		switch {
+		case frame.Op == op:
+			return frame
+		case frame.Op == OpHeartbeat:
+			continue
+		default:
+			c.t.Fatalf("got op %d from client, wanted op %d (data: %s)", frame.Op, op, frame.Data)
+			return Frame{}
+		}
+	}
+}
+
+// ExpectClosed waits for the client to hang up, and returns the status code
+// it closed the connection with (or -1 if it didn't send one).
+func (c *Conn) ExpectClosed() int {
+	c.t.Helper()
+
+	select {
+	case <-c.closed:
+		return int(c.closeStatus)
+	case <-time.After(Timeout):
+		c.t.Fatal("timed out waiting for the client to disconnect")
+		return 0
+	}
+}
+
+func (c *Conn) encode(data any) json.RawMessage {
+	c.t.Helper()
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		c.t.Fatalf("could not encode frame data: %s", err)
+	}
+
+	return raw
+}
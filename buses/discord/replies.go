@@ -0,0 +1,209 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/mmcclimon/marvin"
+	"github.com/mmcclimon/marvin/buses/discord/internal/discord"
+	"github.com/mmcclimon/marvin/trace"
+)
+
+// How replies go out, when they're replying to a message: as new messages
+// in the channel, as Discord replies to the message, or in a thread started
+// from it.
+const (
+	styleMessage   = "message"
+	styleReference = "reference"
+	styleThread    = "thread"
+)
+
+// Discord won't take longer thread names than this.
+const maxThreadName = 100
+
+func validReplyStyle(style string) bool {
+	return style == styleMessage || style == styleReference || style == styleThread
+}
+
+func (d *Discord) handleReply(ctx context.Context, reply marvin.Reply) {
+	switch {
+	case reply.Reaction != "":
+		d.React(ctx, reply.Address, reply.MessageID, reply.Reaction)
+
+	case reply.Delete:
+		if err := d.DeleteMessage(ctx, reply.Ref); err != nil {
+			d.logger.Warn("could not delete message", "ref", reply.Ref, "err", err)
+		}
+
+	case reply.Ref != "" && d.refs.has(reply.Ref):
+		if err := d.EditMessage(ctx, reply.Ref, reply.Text); err != nil {
+			d.logger.Warn("could not edit message", "ref", reply.Ref, "err", err)
+		}
+
+	default:
+		d.sendReply(ctx, reply)
+	}
+}
+
+func (d *Discord) sendReply(ctx context.Context, reply marvin.Reply) {
+	channel := fmt.Sprint(reply.Address)
+	msg := discord.OutgoingMessage{Content: reply.Text}
+
+	thread := reply.Thread
+	if thread == "" && d.replyStyle == styleThread {
+		thread = threadName(reply.Text)
+	}
+
+	switch {
+	case reply.MessageID == "":
+		// nothing to reply to
+
+	case thread != "":
+		// This fails in direct messages and in threads, where replying in
+		// the channel is the best we can do anyway.
+		id, err := d.discord.StartThread(ctx, channel, reply.MessageID, thread)
+		if err != nil {
+			d.logger.Info("could not start thread; replying in channel", "err", err)
+			break
+		}
+
+		channel = id
+
+	case d.replyStyle == styleReference:
+		msg.Reference = &discord.MessageReference{MessageID: reply.MessageID}
+	}
+
+	posted, err := d.post(ctx, channel, msg)
+	if err == nil && reply.Ref != "" {
+		d.refs.put(reply.Ref, sentMessage{channelID: channel, messageID: posted.ID})
+	}
+}
+
+// threadName makes a thread name out of the first line of a reply.
+func threadName(text string) string {
+	name, _, _ := strings.Cut(text, "\n")
+	if runes := []rune(name); len(runes) > maxThreadName {
+		name = string(runes[:maxThreadName-1]) + "…"
+	}
+
+	if name == "" {
+		name = "marvin"
+	}
+
+	return name
+}
+
+// post sends a message, split up or as a file if it's too long, and returns
+// the first message posted.
+func (d *Discord) post(ctx context.Context, channel string, msg discord.OutgoingMessage) (discord.Message, error) {
+	msgs := outgoing(msg, d.attachOver)
+
+	ctx, span := trace.Start(ctx, "discord.send_message",
+		trace.String("channel_id", channel),
+		trace.Int("parts", int64(len(msgs))),
+	)
+	defer span.End()
+
+	var first discord.Message
+
+	for i, msg := range msgs {
+		posted, err := d.discord.CreateMessage(ctx, channel, msg)
+		if err != nil {
+			span.RecordError(err)
+			d.logger.Warn("bad message post", "err", err, "part", i)
+			return first, err
+		}
+
+		if i == 0 {
+			first = posted
+		}
+	}
+
+	return first, nil
+}
+
+// EditMessage replaces the text of the message sent with ref.
+func (d *Discord) EditMessage(ctx context.Context, ref, text string) error {
+	sent, ok := d.refs.get(ref)
+	if !ok {
+		return fmt.Errorf("no message with ref %q", ref)
+	}
+
+	// Edits can't be split up, so the best we can do is cut them short.
+	if runes := []rune(text); len(runes) > discord.MaxMessageLength {
+		text = string(runes[:discord.MaxMessageLength-1]) + "…"
+	}
+
+	return d.discord.EditMessage(ctx, sent.channelID, sent.messageID, text)
+}
+
+// DeleteMessage deletes the message sent with ref.
+func (d *Discord) DeleteMessage(ctx context.Context, ref string) error {
+	sent, ok := d.refs.get(ref)
+	if !ok {
+		return fmt.Errorf("no message with ref %q", ref)
+	}
+
+	d.refs.forget(ref)
+	return d.discord.DeleteMessage(ctx, sent.channelID, sent.messageID)
+}
+
+type sentMessage struct {
+	channelID string
+	messageID string
+}
+
+// We only remember this many refs, forgetting the oldest first.
+const maxRefs = 1000
+
+// sentRefs remembers where messages sent with refs went, so that they can
+// be edited or deleted later.
+type sentRefs struct {
+	mu    sync.Mutex
+	sent  map[string]sentMessage
+	order []string
+}
+
+func (r *sentRefs) put(ref string, msg sentMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.sent == nil {
+		r.sent = make(map[string]sentMessage)
+	}
+
+	if _, ok := r.sent[ref]; !ok {
+		r.order = append(r.order, ref)
+	}
+
+	r.sent[ref] = msg
+
+	for len(r.order) > maxRefs {
+		delete(r.sent, r.order[0])
+		r.order = r.order[1:]
+	}
+}
+
+func (r *sentRefs) get(ref string) (sentMessage, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	msg, ok := r.sent[ref]
+	return msg, ok
+}
+
+func (r *sentRefs) has(ref string) bool {
+	_, ok := r.get(ref)
+	return ok
+}
+
+func (r *sentRefs) forget(ref string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.sent, ref)
+	r.order = slices.DeleteFunc(r.order, func(s string) bool { return s == ref })
+}
@@ -0,0 +1,143 @@
+package discord
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mmcclimon/marvin/buses/discord/internal/discord"
+)
+
+const (
+	codeFence = "```"
+
+	// attachmentName is what long replies are called when they're uploaded
+	// instead of sent.
+	attachmentName = "message.txt"
+)
+
+// outgoing turns a message that might be too long for Discord into what to
+// actually send: the message itself, if it fits; a text file, if it's longer
+// than attachOver; or else several messages, only the first of which keeps
+// the reference.
+func outgoing(msg discord.OutgoingMessage, attachOver int) []discord.OutgoingMessage {
+	length := utf8.RuneCountInString(msg.Content)
+
+	if attachOver > 0 && length > attachOver {
+		msg.Files = append(msg.Files, discord.File{Name: attachmentName, Content: []byte(msg.Content)})
+		msg.Content = ""
+		return []discord.OutgoingMessage{msg}
+	}
+
+	if length <= discord.MaxMessageLength {
+		return []discord.OutgoingMessage{msg}
+	}
+
+	parts := splitMessage(msg.Content, discord.MaxMessageLength)
+	msgs := make([]discord.OutgoingMessage, len(parts))
+
+	for i, part := range parts {
+		msgs[i] = discord.OutgoingMessage{Content: part}
+	}
+
+	msgs[0].Reference = msg.Reference
+	msgs[0].Files = msg.Files
+	return msgs
+}
+
+// splitMessage splits text into pieces of at most limit characters, between
+// lines where it can. A code block that gets split is closed at the end of
+// one piece and opened again, with the same fence, at the start of the next,
+// so that every piece renders properly by itself.
+func splitMessage(text string, limit int) []string {
+	var (
+		parts []string
+		cur   strings.Builder
+		n     int    // characters in cur
+		start int    // characters in cur before anything's been added to it
+		fence string // the line that opened the code block we're in, if any
+	)
+
+	flush := func() {
+		part := strings.TrimRight(cur.String(), "\n")
+		if fence != "" {
+			part += "\n" + codeFence
+		}
+
+		parts = append(parts, part)
+		cur.Reset()
+		n, start = 0, 0
+
+		if fence != "" {
+			cur.WriteString(fence + "\n")
+			n = utf8.RuneCountInString(fence) + 1
+			start = n
+		}
+	}
+
+	for _, line := range strings.SplitAfter(text, "\n") {
+		isFence := strings.HasPrefix(strings.TrimSpace(line), codeFence)
+
+		// If we'll be in a code block after this line, we need room to
+		// close it.
+		reserve := 0
+		if (fence != "") != isFence {
+			reserve = len(codeFence) + 1
+		}
+
+		for rest := line; rest != ""; {
+			room := max(limit-n-reserve, 1)
+			length := utf8.RuneCountInString(rest)
+
+			switch {
+			case length <= room:
+				cur.WriteString(rest)
+				n += length
+				rest = ""
+
+			case n > start:
+				flush()
+
+			default:
+				// The line's too long for a piece of its own.
+				head := cutAt(rest, room)
+				cur.WriteString(head)
+				n += utf8.RuneCountInString(head)
+				rest = rest[len(head):]
+				flush()
+			}
+		}
+
+		if isFence {
+			if fence == "" {
+				fence = strings.TrimSpace(line)
+			} else {
+				fence = ""
+			}
+		}
+	}
+
+	if n > start {
+		parts = append(parts, strings.TrimRight(cur.String(), "\n"))
+	}
+
+	return parts
+}
+
+// cutAt returns as much of s as fits in limit characters, stopping after
+// the last space if there's one in the second half.
+func cutAt(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+
+	head := runes[:limit]
+	for i := len(head) - 1; i > limit/2; i-- {
+		if unicode.IsSpace(head[i]) {
+			return string(head[:i+1])
+		}
+	}
+
+	return string(head)
+}
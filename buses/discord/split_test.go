@@ -0,0 +1,83 @@
+package discord
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func checkParts(t *testing.T, parts []string, limit int) {
+	t.Helper()
+
+	for i, part := range parts {
+		if n := utf8.RuneCountInString(part); n > limit {
+			t.Errorf("part %d is %d characters, over the limit of %d", i, n, limit)
+		}
+
+		if fences := strings.Count(part, codeFence); fences%2 != 0 {
+			t.Errorf("part %d has unbalanced code fences:\n%s", i, part)
+		}
+	}
+}
+
+func TestSplitMessageOnLines(t *testing.T) {
+	text := strings.Repeat("here is a line of text\n", 10)
+	parts := splitMessage(text, 50)
+
+	checkParts(t, parts, 50)
+
+	for i, part := range parts {
+		for _, line := range strings.Split(part, "\n") {
+			if line != "here is a line of text" {
+				t.Errorf("part %d has a broken line %q", i, line)
+			}
+		}
+	}
+
+	if got := strings.Join(parts, "\n"); got != strings.TrimSuffix(text, "\n") {
+		t.Errorf("parts don't add back up to the text:\n%s", got)
+	}
+}
+
+func TestSplitMessageCodeBlocks(t *testing.T) {
+	text := "look at this:\n```go\n" + strings.Repeat("fmt.Println(\"hello\")\n", 10) + "```\nneat, huh?"
+	parts := splitMessage(text, 80)
+
+	checkParts(t, parts, 80)
+
+	if len(parts) < 3 {
+		t.Fatalf("expected the code block to be split up, got %d parts", len(parts))
+	}
+
+	for _, part := range parts[1 : len(parts)-1] {
+		if !strings.HasPrefix(part, "```go\n") {
+			t.Errorf("part in the middle of the code block doesn't reopen it:\n%s", part)
+		}
+	}
+
+	if !strings.HasSuffix(parts[len(parts)-1], "neat, huh?") {
+		t.Errorf("lost the end of the message: %q", parts[len(parts)-1])
+	}
+}
+
+func TestSplitMessageLongLines(t *testing.T) {
+	text := strings.Repeat("word ", 100)
+	parts := splitMessage(text, 64)
+
+	checkParts(t, parts, 64)
+
+	if got := strings.Join(parts, ""); got != text {
+		t.Errorf("parts don't add back up to the text:\n%s", got)
+	}
+
+	for i, part := range parts[:len(parts)-1] {
+		if !strings.HasSuffix(part, " ") {
+			t.Errorf("part %d wasn't split at a space: %q", i, part)
+		}
+	}
+
+	unbroken := strings.Repeat("x", 150)
+	if parts := splitMessage(unbroken, 64); strings.Join(parts, "") != unbroken {
+		t.Errorf("split a line without spaces badly: %q", parts)
+	}
+}
@@ -0,0 +1,62 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mmcclimon/marvin"
+)
+
+// Discord shows the typing indicator for ten seconds, so we have to keep
+// asking for it a bit more often than that.
+const typingInterval = 8 * time.Second
+
+// typing is when to show the typing indicator for a message nobody's replied
+// to yet, so that people know something's happening when a reactor is slow:
+//
+//	[bus.discord.typing]
+//	after = "1s"
+//	limit = "1m"
+//
+// After is how long to wait before showing it, and zero turns it off. Limit
+// is when to give up, for events that never get a reply, and has to be
+// longer than After.
+type typing struct {
+	After time.Duration `mapstructure:"after"`
+	Limit time.Duration `mapstructure:"limit"`
+}
+
+// showTyping shows the typing indicator in the event's channel if it's still
+// not done after a little while, and keeps it up until it is.
+func (d *Discord) showTyping(ctx context.Context, event marvin.Event) {
+	if d.typing.After <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.typing.Limit)
+	defer cancel()
+
+	timer := time.NewTimer(d.typing.After)
+	defer timer.Stop()
+
+	channel := fmt.Sprint(event.Address)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-event.Done():
+			return
+
+		case <-timer.C:
+			if err := d.discord.TriggerTyping(ctx, channel); err != nil {
+				d.logger.Debug("could not show typing indicator", "channel_id", channel, "err", err)
+				return
+			}
+
+			timer.Reset(typingInterval)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Package replay is a bus that plays back a transcript (see package
+// transcript) through a real hub, checking that the bot says what the
+// transcript says it should. It's meant for regression tests that look like
+// chat logs, and is usually run with "marvin replay".
+//
+//	[bus.replay]
+//	type = "replay"
+//	file = "testdata/uptime.txt"
+//	sender = "arthur"       # who the events appear to come from
+//	reply_timeout = "1s"    # how long to wait for the expected replies
+//	settle = "100ms"        # how long to wait for unexpected extra replies
+//
+// Replies to a given line of input may come from several reactors in any
+// order; as long as the right replies arrive, the order doesn't matter.
+//
+// Every line of input becomes a message from sender, with no address, that
+// isn't a DM. Reactors limited to particular channels or to DMs won't see
+// them, so "marvin replay" drops those limits from the config it's given.
+//
+// When the transcript is finished, the bus shuts down the hub: with
+// marvin.ErrShuttingDown if everything matched, or with a *MismatchError if
+// it didn't.
+package replay
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/mmcclimon/marvin"
+	"github.com/mmcclimon/marvin/transcript"
+)
+
+type Replay struct {
+	name   marvin.BusName
+	logger *slog.Logger
+	config
+}
+
+type config struct {
+	File         string
+	Sender       string
+	ReplyTimeout time.Duration `mapstructure:"reply_timeout"`
+	Settle       time.Duration
+}
+
+// MismatchError is returned from Run when the conversation didn't go the way
+// the transcript said it would.
+type MismatchError struct {
+	File string
+	Diff string
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("transcript %s did not match (-want +got):\n%s", e.File, e.Diff)
+}
+
+func Assemble(name marvin.BusName, rawConfig map[string]any) (marvin.Bus, error) {
+	cfg := config{
+		Sender:       "replay",
+		ReplyTimeout: time.Second,
+		Settle:       100 * time.Millisecond,
+	}
+
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.StringToTimeDurationHookFunc(),
+		Result:     &cfg,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bad config for %s bus: %w", name, err)
+	}
+
+	if err := decoder.Decode(rawConfig); err != nil {
+		return nil, fmt.Errorf("bad config for %s bus: %w", name, err)
+	}
+
+	if cfg.File == "" {
+		return nil, fmt.Errorf("bad config for %s bus: no file given", name)
+	}
+
+	return &Replay{
+		name:   name,
+		logger: slog.Default().With("bus", name),
+		config: cfg,
+	}, nil
+}
+
+func (b *Replay) Run(ctx context.Context, comm marvin.BusBundle) error {
+	want, err := transcript.ParseFile(b.File)
+	if err != nil {
+		return fmt.Errorf("could not read transcript: %w", err)
+	}
+
+	turns, err := want.Turns()
+	if err != nil {
+		return fmt.Errorf("bad transcript %s: %w", b.File, err)
+	}
+
+	var got transcript.Transcript
+
+	for _, turn := range turns {
+		event := b.eventFromText(turn.Input.Text)
+
+		select {
+		case <-ctx.Done():
+			return marvin.ErrShuttingDown
+		case comm.Events <- event:
+		}
+
+		replies := b.collectReplies(ctx, comm, len(turn.Replies))
+
+		got = append(got, turn.Input)
+		got = append(got, inExpectedOrder(replies, turn.Replies)...)
+	}
+
+	if diff := transcript.Diff(want, got); diff != "" {
+		return &MismatchError{File: b.File, Diff: diff}
+	}
+
+	b.logger.Info("transcript matched", "file", b.File)
+	return marvin.ErrShuttingDown
+}
+
+// collectReplies waits for n replies (or until the reply timeout passes),
+// then waits a bit longer to catch any we weren't expecting.
+func (b *Replay) collectReplies(ctx context.Context, comm marvin.BusBundle, n int) []transcript.Line {
+	var replies []transcript.Line
+
+	timeout := time.NewTimer(b.ReplyTimeout)
+	defer timeout.Stop()
+
+	for len(replies) < n {
+		select {
+		case <-ctx.Done():
+			return replies
+		case <-timeout.C:
+			return replies
+		case reply := <-comm.Replies:
+			replies = append(replies, transcript.Line{FromBot: true, Text: reply.Text})
+		}
+	}
+
+	settle := time.NewTimer(b.Settle)
+	defer settle.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return replies
+		case <-settle.C:
+			return replies
+		case reply := <-comm.Replies:
+			replies = append(replies, transcript.Line{FromBot: true, Text: reply.Text})
+		}
+	}
+}
+
+// inExpectedOrder puts the replies we got in the order the transcript has
+// them, so that replies from different reactors arriving in a different
+// order don't count as a mismatch. Anything unexpected goes at the end.
+func inExpectedOrder(got, want []transcript.Line) []transcript.Line {
+	remaining := append([]transcript.Line(nil), got...)
+	ordered := make([]transcript.Line, 0, len(got))
+
+	for _, w := range want {
+		for i, line := range remaining {
+			if line == w {
+				ordered = append(ordered, line)
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				break
+			}
+		}
+	}
+
+	return append(ordered, remaining...)
+}
+
+func (b *Replay) eventFromText(text string) marvin.Event {
+	ev := marvin.NewEvent(b)
+	ev.Text = text
+	ev.Sender = b.Sender
+	return ev
+}
+
+func (b *Replay) Name() marvin.BusName { return b.name }
+
+func (b *Replay) SendMessage(_ context.Context, _ any, text string) {
+	b.logger.Warn("replay bus cannot send messages out of band", "text", text)
+}
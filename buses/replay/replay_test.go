@@ -0,0 +1,76 @@
+package replay_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcclimon/marvin"
+	"github.com/mmcclimon/marvin/buses/replay"
+	"github.com/mmcclimon/marvin/registry"
+)
+
+func runReplay(t *testing.T, file string) error {
+	t.Helper()
+
+	hub, err := marvin.FromString(fmt.Sprintf(`
+		[bus.replay]
+		type = "replay"
+		file = %q
+		reply_timeout = "500ms"
+		settle = "50ms"
+
+		[reactor.echo]
+		type = "echo"
+	`, file), registry.Known())
+	if err != nil {
+		t.Fatalf("could not assemble hub: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return hub.RunContext(ctx)
+}
+
+func TestReplay(t *testing.T) {
+	if err := runReplay(t, "testdata/echo.txt"); !errors.Is(err, marvin.ErrShuttingDown) {
+		t.Errorf("replay finished with %v, wanted ErrShuttingDown", err)
+	}
+}
+
+func TestReplayMismatch(t *testing.T) {
+	err := runReplay(t, "testdata/mismatch.txt")
+
+	var mismatch *replay.MismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("replay finished with %v, wanted a mismatch", err)
+	}
+
+	if mismatch.File != "testdata/mismatch.txt" {
+		t.Errorf("mismatch was in %q, wanted testdata/mismatch.txt", mismatch.File)
+	}
+
+	want := strings.Join([]string{
+		"  > hello",
+		"- | echo: >>> goodbye <<<",
+		"+ | echo: >>> hello <<<",
+	}, "\n")
+
+	if mismatch.Diff != want+"\n" {
+		t.Errorf("got diff:\n%s\nwanted:\n%s", mismatch.Diff, want)
+	}
+}
+
+func TestReplayConfig(t *testing.T) {
+	if _, err := replay.Assemble("replay", map[string]any{}); err == nil {
+		t.Error("assembled a replay bus without a file")
+	}
+
+	if _, err := replay.Assemble("replay", map[string]any{"file": "x.txt", "settle": "soon"}); err == nil {
+		t.Error("assembled a replay bus with a bad settle time")
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/mmcclimon/marvin"
+	"github.com/mmcclimon/marvin/trace"
 )
 
 type Term struct {
@@ -31,7 +32,7 @@ func (b *Term) Run(ctx context.Context, comm marvin.BusBundle) error {
 			return nil
 
 		case reply := <-comm.Replies:
-			b.SendMessage(ctx, nil, reply.Text)
+			b.SendMessage(reply.TraceContext(ctx), nil, reply.Text)
 			fmt.Print("> ")
 
 		default:
@@ -62,11 +63,16 @@ func (b *Term) Run(ctx context.Context, comm marvin.BusBundle) error {
 func (b *Term) eventFromText(text string) marvin.Event {
 	ev := marvin.NewEvent(b)
 	ev.Text = text
+	ev.Sender = os.Getenv("USER")
+	ev.Direct = true // it's just you and me here
 	return ev
 }
 
 func (b *Term) Name() marvin.BusName { return b.name }
 
-func (b *Term) SendMessage(_ context.Context, _ any, text string) {
+func (b *Term) SendMessage(ctx context.Context, _ any, text string) {
+	_, span := trace.Start(ctx, "term.send_message")
+	defer span.End()
+
 	fmt.Printf("| %s\n", text)
 }
@@ -18,6 +18,10 @@ func main() {
 
 	flag.Parse()
 
+	if flag.Arg(0) == "replay" {
+		os.Exit(runReplay(flag.Args()[1:], os.Stdout))
+	}
+
 	if len(flag.Args()) > 0 {
 		flag.Usage()
 		os.Exit(1)
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+
+	"github.com/mmcclimon/marvin"
+	"github.com/mmcclimon/marvin/buses/replay"
+	"github.com/mmcclimon/marvin/registry"
+)
+
+// runReplay plays each of the transcripts named in args through a hub built
+// from the config file, with the config's buses replaced by a single replay
+// bus, and writes how each went to out. It returns the exit code.
+func runReplay(args []string, out io.Writer) int {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	configPath := flags.String("c", *configFlag, "path to config file")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: marvin replay [-c config] transcript...")
+		fmt.Fprintln(flags.Output(), "")
+		fmt.Fprintln(flags.Output(), "Each transcript is played through the config's reactors and middleware on a")
+		fmt.Fprintln(flags.Output(), "single replay bus, in place of the config's buses. Reactors' scopes (buses,")
+		fmt.Fprintln(flags.Output(), "channels, exclude_channels, and dm_only) are ignored, so every reactor sees")
+		fmt.Fprintln(flags.Output(), "every replayed message; a warning says which reactors that affects.")
+		fmt.Fprintln(flags.Output(), "")
+		flags.PrintDefaults()
+	}
+
+	_ = flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 1
+	}
+
+	failed := 0
+
+	for _, file := range flags.Args() {
+		err := replayOne(*configPath, file)
+
+		var mismatch *replay.MismatchError
+
+		switch {
+		case err == nil:
+			fmt.Fprintf(out, "ok   %s\n", file)
+		case errors.As(err, &mismatch):
+			fmt.Fprintf(out, "FAIL %s\n%s", file, mismatch.Diff)
+			failed++
+		default:
+			fmt.Fprintf(out, "FAIL %s\n%s\n", file, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+func replayOne(configPath, file string) error {
+	cfg, err := marvin.ConfigFromFile(configPath)
+	if err != nil {
+		return err
+	}
+
+	cfg.Bus = map[string]map[string]any{
+		"replay": {"type": "replay", "file": file},
+	}
+
+	unscope(cfg.Reactor)
+
+	hub, err := cfg.Assemble(registry.Default())
+	if err != nil {
+		return err
+	}
+
+	err = hub.Run()
+	if errors.Is(err, marvin.ErrShuttingDown) {
+		return nil
+	}
+
+	return err
+}
+
+// unscope removes the scope settings from every reactor's config, warning
+// about each reactor that had any. The buses and channels reactors are
+// scoped to don't exist here, and replayed events are never DMs; the replay
+// bus stands in for all of them, so a transcript can't tell whether a
+// reactor's scope would have let a message through.
+func unscope(reactors map[string]map[string]any) {
+	names := make([]string, 0, len(reactors))
+	for name := range reactors {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		var stripped []string
+
+		for _, key := range []string{"buses", "channels", "exclude_channels", "dm_only"} {
+			if _, ok := reactors[name][key]; ok {
+				stripped = append(stripped, key)
+				delete(reactors[name], key)
+			}
+		}
+
+		if len(stripped) > 0 {
+			slog.Warn("ignoring reactor scope for replay", "reactor", name, "settings", stripped)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mmcclimon/marvin/registry"
+)
+
+func TestMain(m *testing.M) {
+	registry.RegisterAllKnownComponents()
+	os.Exit(m.Run())
+}
+
+func TestRunReplay(t *testing.T) {
+	var out strings.Builder
+
+	// The config's echo reactor is scoped to a bus, a channel, and DMs that
+	// replays don't have, so it only answers if they've been dropped.
+	code := runReplay([]string{"-c", "testdata/marvin.toml", "testdata/echo.txt"}, &out)
+	if code != 0 {
+		t.Errorf("exited with %d, wanted 0; output:\n%s", code, &out)
+	}
+
+	if want := "ok   testdata/echo.txt\n"; out.String() != want {
+		t.Errorf("got output %q, wanted %q", &out, want)
+	}
+}
+
+func TestRunReplayMismatch(t *testing.T) {
+	var out strings.Builder
+
+	args := []string{"-c", "testdata/marvin.toml", "testdata/echo.txt", "testdata/mismatch.txt"}
+	if code := runReplay(args, &out); code != 1 {
+		t.Errorf("exited with %d, wanted 1", code)
+	}
+
+	want := strings.Join([]string{
+		"ok   testdata/echo.txt",
+		"FAIL testdata/mismatch.txt",
+		"  > hello",
+		"- | echo: >>> goodbye <<<",
+		"+ | echo: >>> hello <<<",
+	}, "\n") + "\n"
+
+	if out.String() != want {
+		t.Errorf("got output:\n%s\nwanted:\n%s", &out, want)
+	}
+}
+
+func TestRunReplayBadTranscript(t *testing.T) {
+	var out strings.Builder
+
+	if code := runReplay([]string{"-c", "testdata/marvin.toml", "testdata/nope.txt"}, &out); code != 1 {
+		t.Errorf("exited with %d, wanted 1", code)
+	}
+
+	if !strings.HasPrefix(out.String(), "FAIL testdata/nope.txt\n") {
+		t.Errorf("got output %q, wanted a failure", &out)
+	}
+}
+
+func TestUnscopeWarns(t *testing.T) {
+	var logs strings.Builder
+
+	old := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(old) })
+
+	reactors := map[string]map[string]any{
+		"echo":   {"type": "echo", "buses": []string{"term"}, "dm_only": true},
+		"uptime": {"type": "uptime"},
+	}
+
+	unscope(reactors)
+
+	if want := map[string]any{"type": "echo"}; !reflect.DeepEqual(reactors["echo"], want) {
+		t.Errorf("echo's config is %v, wanted %v", reactors["echo"], want)
+	}
+
+	got := logs.String()
+	if !strings.Contains(got, "reactor=echo settings=\"[buses dm_only]\"") {
+		t.Errorf("no warning about echo's scope in logs:\n%s", got)
+	}
+
+	if strings.Contains(got, "reactor=uptime") {
+		t.Errorf("warned about uptime, which has no scope:\n%s", got)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/mitchellh/mapstructure"
 )
@@ -14,14 +15,30 @@ type arbitraryConfig = map[string]any
 type Config struct {
 	Name     string
 	LogLevel slog.Level `toml:"log_level"`
-	Bus      map[string]arbitraryConfig
-	Reactor  map[string]arbitraryConfig
-	err      assemblyError
+
+	// ShutdownTimeout bounds how long the hub waits, on shutdown, for
+	// in-flight events to finish and for shutdown hooks to run.
+	ShutdownTimeout time.Duration `toml:"shutdown_timeout"`
+
+	Bus     map[string]arbitraryConfig
+	Reactor map[string]arbitraryConfig
+
+	// Middleware is ordered, so it's an array of tables ([[middleware]])
+	// rather than a table of tables like buses and reactors.
+	Middleware []arbitraryConfig
+
+	Metrics   MetricsConfig
+	Audit     AuditConfig
+	Tracing   TracingConfig
+	Admin     AdminConfig
+	RateLimit RateLimitConfig `toml:"ratelimit"`
+	err       assemblyError
 }
 
 type Registry interface {
 	BusFor(string) BusAssembler
 	ReactorFor(string) ReactorAssembler
+	MiddlewareFor(string) MiddlewareAssembler
 }
 
 type assemblyError struct {
@@ -36,8 +53,41 @@ func (cfg *Config) Assemble(registry Registry) (*Hub, error) {
 	slog.SetDefault(logger)
 
 	hub := New()
+	hub.metricsConfig = cfg.Metrics
+	hub.adminConfig = cfg.Admin
+
+	if cfg.ShutdownTimeout > 0 {
+		hub.shutdownGrace = cfg.ShutdownTimeout
+	}
+
+	if err := cfg.Admin.validate(); err != nil {
+		cfg.err.add(err)
+	}
+
+	audit, err := newAuditLog(cfg.Audit)
+	if err != nil {
+		cfg.err.add(err)
+	}
+
+	hub.audit = audit
+
+	limiter, err := newRateLimiter(cfg.RateLimit)
+	if err != nil {
+		cfg.err.add(err)
+	}
+
+	hub.limiter = limiter
+
+	tracer, err := newTracer(cfg.Tracing)
+	if err != nil {
+		cfg.err.add(fmt.Errorf("error setting up tracing: %w", err))
+	}
+
+	hub.tracer = tracer
+
 	cfg.assembleBuses(hub, registry)
 	cfg.assembleReactors(hub, registry)
+	cfg.assembleMiddleware(hub, registry)
 
 	return hub, cfg.err.OrNil()
 }
@@ -69,7 +119,19 @@ func (cfg *Config) assembleReactors(hub *Hub, registry Registry) {
 			continue
 		}
 
+		scope, err := extractScope(reactorConfig)
+		if err == nil {
+			err = scope.validate(hub)
+		}
+
+		if err != nil {
+			cfg.err.add(fmt.Errorf("bad scope for reactor '%s': %w", name, err))
+			continue
+		}
+
 		identifier := ReactorName(name)
+		hub.reactorScopes[identifier] = scope
+
 		reactor, err := assembler(identifier, reactorConfig)
 		if err != nil {
 			cfg.err.add(fmt.Errorf("error assembling reactor '%s': %w", name, err))
@@ -81,7 +143,7 @@ func (cfg *Config) assembleReactors(hub *Hub, registry Registry) {
 }
 
 type componentAssembler interface {
-	BusAssembler | ReactorAssembler
+	BusAssembler | ReactorAssembler | MiddlewareAssembler
 }
 
 func extractAssembler[T componentAssembler](
@@ -0,0 +1,143 @@
+package marvin
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ConversationKey identifies a conversation: one sender, talking in one
+// place on one bus.
+type ConversationKey struct {
+	Bus     BusName
+	Address string
+	Sender  string
+}
+
+func (e *Event) ConversationKey() ConversationKey {
+	key := ConversationKey{Bus: e.SourceBus, Sender: e.Sender}
+	if e.Address != nil {
+		key.Address = fmt.Sprint(e.Address)
+	}
+
+	return key
+}
+
+// Conversations lets a reactor carry on a dialog. After a reactor claims an
+// event's conversation, the next events in that conversation go only to that
+// reactor, instead of to every reactor, until the claim times out or is
+// released. A reactor asking a follow-up question looks something like this:
+//
+//	case event := <-comm.Events:
+//		key := event.ConversationKey()
+//		if comm.Conversations.Active(key) {
+//			// this is the answer to our question
+//			deploy(r.pending[key], event.Text)
+//			comm.Conversations.Release(key)
+//			...
+//		}
+//
+//		r.pending[key] = event.Text
+//		comm.Conversations.Claim(key, time.Minute)
+//		comm.Replies <- event.Reply("which environment?")
+//
+// Claims time out quietly, so reactors keeping state per conversation should
+// check Active before trusting it. The zero Conversations (which reactors run
+// outside a hub get) never claims anything.
+type Conversations struct {
+	reactor ReactorName
+	claims  *claims
+}
+
+// Claim claims the conversation for timeout, or extends an existing claim.
+// It returns false if another reactor already holds it.
+func (c Conversations) Claim(key ConversationKey, timeout time.Duration) bool {
+	if c.claims == nil {
+		return false
+	}
+
+	return c.claims.claim(key, c.reactor, time.Now().Add(timeout))
+}
+
+// Release gives up a claim on the conversation, if this reactor has one.
+func (c Conversations) Release(key ConversationKey) {
+	if c.claims == nil {
+		return
+	}
+
+	c.claims.release(key, c.reactor)
+}
+
+// Active reports whether this reactor holds a live claim on the
+// conversation.
+func (c Conversations) Active(key ConversationKey) bool {
+	if c.claims == nil {
+		return false
+	}
+
+	owner, ok := c.claims.owner(key, time.Now())
+	return ok && owner == c.reactor
+}
+
+type claims struct {
+	mu     sync.Mutex
+	claims map[ConversationKey]claim
+}
+
+type claim struct {
+	reactor ReactorName
+	expires time.Time
+}
+
+func newClaims() *claims {
+	return &claims{claims: make(map[ConversationKey]claim)}
+}
+
+func (cl *claims) claim(key ConversationKey, reactor ReactorName, expires time.Time) bool {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	now := time.Now()
+
+	// Conversations are few and short, so it's cheap to tidy up as we go.
+	for k, c := range cl.claims {
+		if now.After(c.expires) {
+			delete(cl.claims, k)
+		}
+	}
+
+	if existing, ok := cl.claims[key]; ok && existing.reactor != reactor {
+		return false
+	}
+
+	cl.claims[key] = claim{reactor: reactor, expires: expires}
+	return true
+}
+
+func (cl *claims) release(key ConversationKey, reactor ReactorName) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	if cl.claims[key].reactor == reactor {
+		delete(cl.claims, key)
+	}
+}
+
+// owner returns the reactor holding a live claim on the conversation, if
+// there is one.
+func (cl *claims) owner(key ConversationKey, now time.Time) (ReactorName, bool) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	c, ok := cl.claims[key]
+	if !ok {
+		return "", false
+	}
+
+	if now.After(c.expires) {
+		delete(cl.claims, key)
+		return "", false
+	}
+
+	return c.reactor, true
+}
@@ -0,0 +1,154 @@
+package marvin_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcclimon/marvin"
+	"github.com/mmcclimon/marvin/marvintest"
+	"github.com/mmcclimon/marvin/registry"
+)
+
+// deployer asks which environment to deploy to, and claims the conversation
+// so it gets the answer.
+type deployer struct {
+	timeout time.Duration
+	pending map[marvin.ConversationKey]string
+}
+
+func (d *deployer) Run(ctx context.Context, comm marvin.ReactorBundle) error {
+	for {
+		var event marvin.Event
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case event = <-comm.Events:
+		}
+
+		key := event.ConversationKey()
+		var reply marvin.Reply
+
+		if comm.Conversations.Active(key) {
+			reply = event.Reply("deploying %s to %s", d.pending[key], event.Text)
+			comm.Conversations.Release(key)
+		} else if what, ok := strings.CutPrefix(event.Text, "deploy "); ok {
+			d.pending[key] = what
+			comm.Conversations.Claim(key, d.timeout)
+			reply = event.Reply("which environment?")
+		} else {
+			continue
+		}
+
+		event.MarkHandled()
+
+		select {
+		case comm.Replies <- reply:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// bystander answers everything except requests to deploy.
+type bystander struct{}
+
+func (bystander) Run(ctx context.Context, comm marvin.ReactorBundle) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event := <-comm.Events:
+			if strings.HasPrefix(event.Text, "deploy ") {
+				continue
+			}
+
+			event.MarkHandled()
+
+			select {
+			case comm.Replies <- event.Reply("heard: %s", event.Text):
+			case <-ctx.Done():
+			}
+		}
+	}
+}
+
+func startConversationHub(t *testing.T, timeout time.Duration) *marvintest.Bus {
+	t.Helper()
+
+	reg := registry.Known()
+	reg.RegisterReactor("deployer", func(marvin.ReactorName, map[string]any) (marvin.Reactor, error) {
+		return &deployer{timeout: timeout, pending: make(map[marvin.ConversationKey]string)}, nil
+	})
+	reg.RegisterReactor("bystander", func(marvin.ReactorName, map[string]any) (marvin.Reactor, error) {
+		return bystander{}, nil
+	})
+
+	hub := marvintest.StartHub(t, `
+		[bus.test]
+		type = "marvintest"
+
+		[reactor.deployer]
+		type = "deployer"
+
+		[reactor.bystander]
+		type = "bystander"
+	`, reg)
+
+	return hub.Bus("test")
+}
+
+func TestConversationClaim(t *testing.T) {
+	bus := startConversationHub(t, time.Minute)
+	arthur := []marvintest.EventOption{
+		marvintest.WithSender("arthur"),
+		marvintest.WithAddress("general"),
+	}
+
+	bus.Send("deploy the answer", arthur...)
+	bus.ExpectReply("which environment?")
+
+	// Other people, and arthur elsewhere, aren't part of the conversation.
+	bus.Send("hello", marvintest.WithSender("ford"), marvintest.WithAddress("general"))
+	bus.ExpectReply("heard: hello")
+
+	bus.Send("hello", marvintest.WithSender("arthur"), marvintest.WithAddress("random"))
+	bus.ExpectReply("heard: hello")
+
+	// The answer only goes to the deployer.
+	bus.Send("production", arthur...)
+	bus.ExpectReply("deploying the answer to production")
+	bus.ExpectNoReply(50 * time.Millisecond)
+
+	// Once it's released, everyone hears arthur again.
+	bus.Send("production", arthur...)
+	bus.ExpectReply("heard: production")
+}
+
+func TestConversationExpiry(t *testing.T) {
+	bus := startConversationHub(t, 100*time.Millisecond)
+
+	bus.Send("deploy the answer", marvintest.WithSender("arthur"))
+	bus.ExpectReply("which environment?")
+
+	time.Sleep(150 * time.Millisecond)
+
+	bus.Send("production", marvintest.WithSender("arthur"))
+	bus.ExpectReply("heard: production")
+	bus.ExpectNoReply(50 * time.Millisecond)
+}
+
+func TestConversationsOutsideHub(t *testing.T) {
+	var conversations marvin.Conversations
+	key := marvin.ConversationKey{Bus: "test", Sender: "arthur"}
+
+	if conversations.Claim(key, time.Minute) {
+		t.Error("zero Conversations claimed a conversation")
+	}
+
+	if conversations.Active(key) {
+		t.Error("zero Conversations has an active conversation")
+	}
+}
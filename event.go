@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -11,12 +12,55 @@ const (
 	eventTimeout = 250 * time.Millisecond
 )
 
+// EventKind is what happened to make an event.
+type EventKind int
+
+const (
+	// Someone said something; this is the zero value.
+	KindMessage EventKind = iota
+	// Someone reacted to a message: Reaction is what with, and MessageID is
+	// which message. Reactors only see these if their scope asks for them,
+	// as with the kinds below.
+	KindReaction
+	// Someone edited a message: Text is what it says now.
+	KindEdit
+	// Someone deleted a message. All we know is MessageID and Address.
+	KindDelete
+)
+
+var eventKinds = []EventKind{KindMessage, KindReaction, KindEdit, KindDelete}
+
+func (k EventKind) String() string {
+	switch k {
+	case KindMessage:
+		return "message"
+	case KindReaction:
+		return "reaction"
+	case KindEdit:
+		return "edit"
+	case KindDelete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
 type Event struct {
+	Kind      EventKind
 	Text      string
 	SourceBus BusName
 	Address   any
+	Sender    string
+	Roles     []string // the sender's roles, on buses that have them
+	Direct    bool     // a direct message, rather than one in a shared channel
+	MessageID string   // the bus's id for the message, on buses that have them
+	Reaction  string   // for reaction events, the emoji
 	id        uint64
 	watchdog  *time.Timer
+	created   time.Time
+	received  time.Time
+	trace     *eventTrace
+	inFlight  *atomic.Int64 // the hub's count, once it's dispatched us
 
 	// look, this is super weird, but I just want a done channel
 	ctx    context.Context
@@ -27,6 +71,38 @@ type Reply struct {
 	Bus     BusName
 	Address any
 	Text    string
+	EventID uint64
+
+	// MessageID is the message this replies to, if the bus gave it an id.
+	MessageID string
+
+	// Reaction, if set, makes this a reaction to the message MessageID,
+	// rather than something to say. Buses that can't react say it instead.
+	Reaction string
+
+	// Thread, if set, starts a thread with this name from the message
+	// MessageID, and says Text there. On Discord, the thread has the same id
+	// as the message, so a reactor can claim the conversation in it ahead of
+	// time, with MessageID as the key's address. Buses without threads just
+	// say Text.
+	Thread string
+
+	// Ref names the message this reply sends, so that later replies with the
+	// same Ref edit it instead of sending a new one, or delete it if Delete
+	// is set. Refs are shared by everything replying on a bus, so they should
+	// be distinctive, like "deploy-123". Buses that can't edit messages
+	// send every reply and drop deletes.
+	Ref    string
+	Delete bool
+
+	// Reactor is the reactor that sent the reply; it's filled in by the hub,
+	// and is empty for replies the hub makes itself.
+	Reactor ReactorName
+
+	received time.Time // when the hub got the event we're replying to
+	watchdog bool      // true if this is the watchdog's fallback reply
+	trace    *eventTrace
+	inFlight *atomic.Int64 // counts us until the hub is done with us
 }
 
 func NewEvent(source Bus) Event {
@@ -34,6 +110,7 @@ func NewEvent(source Bus) Event {
 	evt := Event{
 		id:        nextID(),
 		SourceBus: source.Name(),
+		created:   time.Now(),
 		ctx:       ctx,
 		cancel:    cancel,
 	}
@@ -41,9 +118,13 @@ func NewEvent(source Bus) Event {
 	return evt
 }
 
-func (e *Event) setWatchdog(ch chan<- Reply) {
+func (e *Event) setWatchdog(ch chan<- Reply, onFire func()) {
 	e.watchdog = time.AfterFunc(eventTimeout, func() {
-		ch <- e.Reply("does not compute")
+		onFire()
+
+		reply := e.Reply("does not compute")
+		reply.watchdog = true
+		ch <- reply
 	})
 }
 
@@ -52,7 +133,9 @@ func (e *Event) ID() uint64 {
 }
 
 func (e *Event) MarkHandled() {
-	e.watchdog.Stop()
+	if e.watchdog != nil {
+		e.watchdog.Stop()
+	}
 }
 
 func (e *Event) Done() <-chan struct{} {
@@ -60,14 +143,35 @@ func (e *Event) Done() <-chan struct{} {
 }
 
 func (e *Event) Reply(format string, args ...any) Reply {
+	// The reply counts as in flight from here until the hub has handed it
+	// to its bus. It has to start counting before the event stops, so that
+	// there's never a moment when shutdown can't see either of them.
+	if e.inFlight != nil {
+		e.inFlight.Add(1)
+	}
+
 	e.cancel()
+
 	return Reply{
-		Bus:     e.SourceBus,
-		Address: e.Address,
-		Text:    fmt.Sprintf(format, args...),
+		Bus:       e.SourceBus,
+		Address:   e.Address,
+		Text:      fmt.Sprintf(format, args...),
+		EventID:   e.id,
+		MessageID: e.MessageID,
+		received:  e.received,
+		trace:     e.trace,
+		inFlight:  e.inFlight,
 	}
 }
 
+// React returns a reply that reacts to the event's message with emoji, like
+// a checkmark to say "done" without saying anything.
+func (e *Event) React(emoji string) Reply {
+	reply := e.Reply("")
+	reply.Reaction = emoji
+	return reply
+}
+
 var nextEventID struct {
 	mu sync.Mutex
 	id uint64
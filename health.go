@@ -0,0 +1,217 @@
+package marvin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A HealthReporter is a component that knows more about its health than
+// just whether it's running; a bus holding a connection open should return
+// an error from Healthy when it isn't connected. The hub won't report itself
+// ready until all of its HealthReporters are healthy.
+type HealthReporter interface {
+	Healthy() error
+}
+
+type componentKind string
+
+const (
+	kindBus     componentKind = "bus"
+	kindReactor componentKind = "reactor"
+)
+
+// componentStatus tracks what the hub knows about a single bus or reactor.
+type componentStatus struct {
+	kind      componentKind
+	name      string
+	component any
+	stopped   chan struct{} // closed when the component exits
+
+	mu        sync.Mutex
+	running   bool
+	disabled  bool
+	lastErr   error
+	lastErrAt time.Time
+}
+
+// ComponentHealth is the JSON representation of a component's status.
+type ComponentHealth struct {
+	Kind        componentKind `json:"kind"`
+	Name        string        `json:"name"`
+	Running     bool          `json:"running"`
+	Ready       bool          `json:"ready"`
+	Disabled    bool          `json:"disabled,omitempty"`
+	Status      string        `json:"status,omitempty"`
+	LastError   string        `json:"last_error,omitempty"`
+	LastErrorAt *time.Time    `json:"last_error_at,omitempty"`
+}
+
+type healthReport struct {
+	Status     string            `json:"status"`
+	Components []ComponentHealth `json:"components"`
+}
+
+func (h *Hub) newStatus(kind componentKind, name string, component any) *componentStatus {
+	status := &componentStatus{
+		kind:      kind,
+		name:      name,
+		component: component,
+		stopped:   make(chan struct{}),
+	}
+
+	h.statuses = append(h.statuses, status)
+	return status
+}
+
+func (s *componentStatus) setRunning(running bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.running = running
+}
+
+// exited notes that the component's Run has returned, for good.
+func (s *componentStatus) exited() {
+	s.setRunning(false)
+	close(s.stopped)
+}
+
+// setDisabled turns a reactor off (or back on); the hub doesn't send events
+// to disabled reactors.
+func (s *componentStatus) setDisabled(disabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.disabled = disabled
+}
+
+func (s *componentStatus) isDisabled() bool {
+	if s == nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.disabled
+}
+
+func (s *componentStatus) recordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastErr = err
+	s.lastErrAt = time.Now()
+}
+
+func (s *componentStatus) health() ComponentHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := ComponentHealth{
+		Kind:     s.kind,
+		Name:     s.name,
+		Running:  s.running,
+		Ready:    s.running,
+		Disabled: s.disabled,
+	}
+
+	if !s.running {
+		ch.Status = "not running"
+	} else if reporter, ok := s.component.(HealthReporter); ok {
+		if err := reporter.Healthy(); err != nil {
+			ch.Ready = false
+			ch.Status = err.Error()
+		}
+	}
+
+	if s.lastErr != nil {
+		at := s.lastErrAt
+		ch.LastError = s.lastErr.Error()
+		ch.LastErrorAt = &at
+	}
+
+	return ch
+}
+
+// forwardErrors passes along errors from a single component to the hub,
+// making a note of them on the way.
+func (h *Hub) forwardErrors(ctx context.Context, status *componentStatus, ch <-chan error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case err := <-ch:
+			status.recordError(err)
+
+			select {
+			case h.errs <- err:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+func (h *Hub) healthReport() (healthReport, bool) {
+	report := healthReport{Status: "ok"}
+	ready := !h.draining.Load()
+
+	for _, status := range h.statuses {
+		ch := status.health()
+		ready = ready && ch.Ready
+		report.Components = append(report.Components, ch)
+	}
+
+	sort.Slice(report.Components, func(i, j int) bool {
+		a, b := report.Components[i], report.Components[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+
+		return a.Name < b.Name
+	})
+
+	switch {
+	case h.draining.Load():
+		report.Status = "shutting down"
+	case !ready:
+		report.Status = "unavailable"
+	}
+
+	return report, ready
+}
+
+// handleHealthz reports that the process is alive; it's always OK as long
+// as the hub is running.
+func (h *Hub) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	report, _ := h.healthReport()
+	report.Status = "ok"
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleReadyz reports whether every component is running and healthy.
+func (h *Hub) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	report, ready := h.healthReport()
+
+	code := http.StatusOK
+	if !ready {
+		code = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, code, report)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
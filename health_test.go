@@ -0,0 +1,109 @@
+package marvin_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mmcclimon/marvin"
+	"github.com/mmcclimon/marvin/marvintest"
+	"github.com/mmcclimon/marvin/registry"
+)
+
+// flakyBus is a fake bus that's only healthy when it's told to be.
+type flakyBus struct {
+	*marvintest.Bus
+	healthy atomic.Bool
+}
+
+func (b *flakyBus) Healthy() error {
+	if !b.healthy.Load() {
+		return errors.New("not connected")
+	}
+
+	return nil
+}
+
+type healthReport struct {
+	Status     string                   `json:"status"`
+	Components []marvin.ComponentHealth `json:"components"`
+}
+
+func checkHealth(t *testing.T, url string) (int, healthReport) {
+	t.Helper()
+
+	code, body := request(t, http.MethodGet, url, "", nil)
+
+	var report healthReport
+	if err := json.Unmarshal(body, &report); err != nil {
+		t.Fatalf("bad health report from %s: %s\n%s", url, err, body)
+	}
+
+	return code, report
+}
+
+func TestReadiness(t *testing.T) {
+	addr := freeAddr(t)
+	flaky := &flakyBus{}
+
+	reg := registry.Known()
+	reg.RegisterBus("flaky", func(name marvin.BusName, _ map[string]any) (marvin.Bus, error) {
+		flaky.Bus = marvintest.NewBus(t, name)
+		return flaky, nil
+	})
+
+	marvintest.StartHub(t, fmt.Sprintf(`
+		[bus.flaky]
+		type = "flaky"
+
+		[reactor.echo]
+		type = "echo"
+
+		[metrics]
+		listen = %q
+	`, addr), reg)
+
+	readyz := "http://" + addr + "/readyz"
+
+	eventually(t, "the bus to report itself unhealthy", func() bool {
+		code, report := checkHealth(t, readyz)
+		if code != http.StatusServiceUnavailable || report.Status != "unavailable" {
+			return false
+		}
+
+		for _, c := range report.Components {
+			if c.Name == "flaky" {
+				return c.Running && !c.Ready && c.Status == "not connected"
+			}
+		}
+
+		return false
+	})
+
+	// Not ready isn't the same as not alive.
+	if code, report := checkHealth(t, "http://"+addr+"/healthz"); code != http.StatusOK || report.Status != "ok" {
+		t.Errorf("healthz said %d %q while the bus was unhealthy", code, report.Status)
+	}
+
+	flaky.healthy.Store(true)
+
+	var report healthReport
+	eventually(t, "the hub to be ready", func() bool {
+		var code int
+		code, report = checkHealth(t, readyz)
+		return code == http.StatusOK && report.Status == "ok"
+	})
+
+	if len(report.Components) != 2 {
+		t.Errorf("got %d components, wanted the bus and the reactor: %+v", len(report.Components), report.Components)
+	}
+
+	for _, c := range report.Components {
+		if !c.Running || !c.Ready {
+			t.Errorf("component %s isn't running and ready: %+v", c.Name, c)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package marvin_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mmcclimon/marvin/marvintest"
+)
+
+// freeAddr returns a loopback address with a port nobody's listening on, for
+// the hub's HTTP listeners.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not find a free port: %s", err)
+	}
+
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// request makes an HTTP request, retrying until the server's listening, and
+// returns the status code and body. If body isn't nil, it's sent as JSON.
+func request(t *testing.T, method, url, token string, body any) (int, []byte) {
+	t.Helper()
+
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+
+	deadline := time.Now().Add(marvintest.Timeout)
+
+	for {
+		req, err := http.NewRequest(method, url, bytes.NewReader(payload))
+		if err != nil {
+			t.Fatalf("bad request: %s", err)
+		}
+
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s %s failed: %s", method, url, err)
+			}
+
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+
+		data, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatalf("could not read response from %s %s: %s", method, url, err)
+		}
+
+		return res.StatusCode, data
+	}
+}
+
+// eventually fails the test if cond doesn't become true in time.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(marvintest.Timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
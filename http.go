@@ -0,0 +1,51 @@
+package marvin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// serveMetrics runs the listener for metrics and health checks until ctx is
+// cancelled.
+func (h *Hub) serveMetrics(ctx context.Context) error {
+	metricsPath := h.metricsConfig.Path
+	if metricsPath == "" {
+		metricsPath = "/metrics"
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, promhttp.HandlerFor(h.metrics.registry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/healthz", h.handleHealthz)
+	mux.HandleFunc("/readyz", h.handleReadyz)
+
+	return serve(ctx, "metrics and health checks", h.metricsConfig.Listen, mux)
+}
+
+// serve runs an HTTP server until ctx is cancelled.
+func serve(ctx context.Context, what string, addr string, handler http.Handler) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	slog.Info("serving "+what, "addr", server.Addr)
+
+	err := server.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return fmt.Errorf("http listener for %s failed: %w", what, err)
+}
@@ -5,20 +5,44 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
+	"github.com/mmcclimon/marvin/trace"
 	"golang.org/x/sync/errgroup"
 )
 
 type Hub struct {
 	buses    map[BusName]Bus
 	reactors map[ReactorName]Reactor
-	events   chan Event
-	replies  chan Reply
-	errs     chan error
+
+	reactorScopes map[ReactorName]reactorScope
+	claims        *claims
+	events        chan Event
+	replies       chan Reply
+	errs          chan error
 
 	reactorChs map[ReactorName]chan Event
 	busChs     map[BusName]chan Reply
+
+	metrics       *hubMetrics
+	metricsConfig MetricsConfig
+	shutdownGrace time.Duration
+	adminConfig   AdminConfig
+	statuses      []*componentStatus
+	reactorStatus map[ReactorName]*componentStatus
+	busStatus     map[BusName]*componentStatus
+
+	draining   atomic.Bool
+	inFlight   atomic.Int64
+	lastReply  atomic.Int64 // unix nanoseconds
+	audit      *auditLog
+	limiter    *rateLimiter
+	middleware []namedMiddleware
+	tracer     *trace.Tracer
+	onError    func(error)
 }
 
 func New() *Hub {
@@ -31,21 +55,92 @@ func New() *Hub {
 
 		reactorChs: make(map[ReactorName]chan Event),
 		busChs:     make(map[BusName]chan Reply),
+
+		reactorStatus: make(map[ReactorName]*componentStatus),
+		reactorScopes: make(map[ReactorName]reactorScope),
+		claims:        newClaims(),
+		busStatus:     make(map[BusName]*componentStatus),
+
+		metrics:       newHubMetrics(),
+		shutdownGrace: defaultShutdownTimeout,
 	}
 }
 
+// OnError arranges for f to be called with every non-fatal error the hub's
+// components report. It's called from the hub's main loop, so it mustn't
+// block, and it has to be set before the hub runs.
+func (h *Hub) OnError(f func(error)) {
+	h.onError = f
+}
+
+// Run runs the hub until one of its components exits or we catch a signal.
 func (h *Hub) Run() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go h.sigChan(ctx, cancel)
+
+	return h.RunContext(ctx)
+}
+
+// RunContext is like Run, but doesn't install any signal handlers; the hub
+// shuts down when ctx is cancelled instead.
+func (h *Hub) RunContext(ctx context.Context) error {
 	// Alright, so we're gonna set up a context here, and then an error group,
 	// which will run all the channels and reactors, so we'll shut down if any
 	// of them error out.
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
-	eg, ctx := errgroup.WithContext(ctx)
+	// The audit log and tracer get their own context, so that they can write
+	// out whatever they have left after everything else is done.
+	var background sync.WaitGroup
+	bgCtx, bgCancel := context.WithCancel(context.Background())
 
-	h.startComponents(ctx, eg)
-	go h.sigChan(ctx, cancel)
-	go h.ioLoop(ctx)
+	defer func() {
+		bgCancel()
+		background.Wait()
+	}()
+
+	if h.audit != nil {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			h.audit.run(bgCtx)
+		}()
+	}
+
+	if h.tracer != nil {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			h.tracer.Run(bgCtx)
+		}()
+	}
+
+	// Components run on their own context, which isn't cancelled until
+	// we've drained everything in flight and run the shutdown hooks. The
+	// error group's context is just the signal that it's time to start
+	// shutting down.
+	runCtx, stopComponents := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopComponents()
+
+	eg, shutdownCtx := errgroup.WithContext(ctx)
+
+	h.startComponents(runCtx, eg)
+	go h.ioLoop(runCtx)
+
+	if h.metricsConfig.Listen != "" {
+		eg.Go(func() error { return h.serveMetrics(runCtx) })
+	}
+
+	if h.adminConfig.Listen != "" {
+		eg.Go(func() error { return h.serveAdmin(runCtx, cancel) })
+	}
+
+	<-shutdownCtx.Done()
+	h.shutdown()
+	stopComponents()
 
 	return eg.Wait()
 }
@@ -55,14 +150,20 @@ func (h *Hub) startComponents(ctx context.Context, eg *errgroup.Group) {
 		replyCh := make(chan Reply)
 		h.busChs[name] = replyCh
 
+		status := h.newStatus(kindBus, string(name), bus)
+		h.busStatus[name] = status
+		errCh := make(chan error)
+		go h.forwardErrors(ctx, status, errCh)
+
 		bb := BusBundle{
 			Events:  h.events,
 			Replies: replyCh,
-			Errors:  h.errs,
+			Errors:  errCh,
 		}
 
 		slog.Info("starting bus", "name", name)
-		eg.Go(h.wrapBusFunc(ctx, bus.Run, bb))
+		h.metrics.registerComponent(string(name), bus)
+		eg.Go(h.wrapBusFunc(ctx, bus.Run, bb, status))
 	}
 
 	for name, reactor := range h.reactors {
@@ -71,13 +172,27 @@ func (h *Hub) startComponents(ctx context.Context, eg *errgroup.Group) {
 		evtCh := make(chan Event)
 		h.reactorChs[name] = evtCh
 
+		// Each reactor gets its own reply and error channels, so that we know
+		// who sent what.
+		replyCh := make(chan Reply)
+		go h.forwardReplies(ctx, name, replyCh)
+
+		status := h.newStatus(kindReactor, string(name), reactor)
+		h.reactorStatus[name] = status
+		errCh := make(chan error)
+		go h.forwardErrors(ctx, status, errCh)
+
 		bundle := ReactorBundle{
 			Events:  evtCh,
-			Replies: h.replies,
-			Errors:  h.errs,
+			Replies: replyCh,
+			Errors:  errCh,
+
+			Conversations: Conversations{reactor: name, claims: h.claims},
+			Presences:     Presences{buses: h.buses},
 		}
 
-		eg.Go(h.wrapReactorFunc(ctx, reactor.Run, bundle))
+		h.metrics.registerComponent(string(name), reactor)
+		eg.Go(h.wrapReactorFunc(ctx, reactor.Run, bundle, status))
 	}
 }
 
@@ -103,23 +218,240 @@ func (h *Hub) ioLoop(ctx context.Context) {
 			return
 
 		case err := <-h.errs:
-			slog.Debug("caught non-fatal error", "err", err)
+			h.noteError(err)
 
 		case event := <-h.events:
+			if h.draining.Load() {
+				slog.Debug("dropping event during shutdown", "id", event.ID())
+				event.cancel()
+				continue
+			}
+
+			start := time.Now()
+			event.received = start
+
+			if ok, scope := h.limiter.allow(event, start); !ok {
+				h.throttle(ctx, event, scope)
+				continue
+			}
+
+			replies, droppedBy := h.filterEvent(ctx, &event)
+			if droppedBy != "" {
+				h.audit.recordFiltered(event, droppedBy)
+				h.sendLater(ctx, replies...)
+				event.cancel()
+				continue
+			}
+
+			h.sendLater(ctx, replies...)
+
 			slog.LogAttrs(ctx, slog.LevelDebug,
 				"dispatching event",
 				slog.Uint64("id", event.ID()),
 				slog.String("text", event.Text),
 			)
 
-			event.setWatchdog(h.replies)
+			h.metrics.eventsReceived.WithLabelValues(string(event.SourceBus)).Inc()
+			h.audit.recordEvent(event)
+			h.startEventTrace(&event)
 
-			for _, ch := range h.reactorChs {
-				ch <- event
+			// Nobody has to answer anything but messages, so nothing else
+			// gets a watchdog or holds up shutdown; their replies do,
+			// though, like everyone's.
+			event.inFlight = &h.inFlight
+
+			if event.Kind == KindMessage {
+				h.inFlight.Add(1)
+				context.AfterFunc(event.ctx, func() { h.inFlight.Add(-1) })
+
+				event.setWatchdog(h.replies, h.metrics.watchdogFired.Inc)
 			}
 
+			dispatch := event.trace.startDispatch()
+
+			if !h.dispatch(ctx, event) {
+				return
+			}
+
+			dispatch.End()
+			h.metrics.observeDispatch(start)
+
 		case reply := <-h.replies:
-			h.busChs[reply.Bus] <- reply
+			if !h.handleReply(ctx, reply) {
+				return
+			}
+		}
+	}
+}
+
+func (h *Hub) noteError(err error) {
+	h.metrics.errors.Inc()
+	slog.Debug("caught non-fatal error", "err", err)
+
+	if h.onError != nil {
+		h.onError(err)
+	}
+}
+
+// handleReply delivers reply and stops counting it as in flight. It returns
+// false if ctx is done.
+func (h *Hub) handleReply(ctx context.Context, reply Reply) bool {
+	ok := h.deliver(ctx, reply)
+
+	if reply.inFlight != nil {
+		reply.inFlight.Add(-1)
+	}
+
+	return ok
+}
+
+// deliver passes a reply through the middleware to its bus. It returns false
+// if ctx is done.
+func (h *Hub) deliver(ctx context.Context, reply Reply) bool {
+	h.lastReply.Store(time.Now().UnixNano())
+
+	if !h.filterReply(ctx, &reply) {
+		return true
+	}
+
+	// Middleware can send a reply anywhere, including nowhere.
+	busCh, ok := h.busChs[reply.Bus]
+	if !ok {
+		slog.Warn("dropping reply to unknown bus", "bus", reply.Bus, "reactor", reply.Reactor)
+		return true
+	}
+
+	h.audit.recordReply(reply)
+
+	if !h.adaptReply(&reply) {
+		return true
+	}
+
+	select {
+	case busCh <- reply:
+	case <-h.busStatus[reply.Bus].stopped:
+		slog.Warn("dropping reply to stopped bus", "bus", reply.Bus)
+	case <-ctx.Done():
+		return false
+	}
+
+	return true
+}
+
+// dispatch hands event to the reactors that should see it: whoever's
+// claimed its conversation, if it's a message and anyone has, and otherwise
+// every enabled reactor whose scope includes it. It returns false if ctx is
+// done.
+func (h *Hub) dispatch(ctx context.Context, event Event) bool {
+	targets := h.reactorChs
+	claimed := false
+
+	// Conversations are about what people say, so only messages go to
+	// whoever's claimed them.
+	if owner, ok := h.claims.owner(event.ConversationKey(), time.Now()); ok && event.Kind == KindMessage {
+		if h.reactorStatus[owner].isDisabled() {
+			h.claims.release(event.ConversationKey(), owner)
+		} else {
+			targets = map[ReactorName]chan Event{owner: h.reactorChs[owner]}
+			claimed = true
+		}
+	}
+
+	for name, ch := range targets {
+		status := h.reactorStatus[name]
+		if !claimed && (status.isDisabled() || !h.reactorScopes[name].allows(event)) {
+			continue
+		}
+
+		event.trace.reactorStarted(name)
+
+		// A reactor may not be ready for this event because it's still
+		// trying to reply to the last one, or report an error, so we keep
+		// taking those while we wait; otherwise we'd be waiting for each
+		// other.
+		for sent := false; !sent; {
+			select {
+			case ch <- event:
+				sent = true
+			case <-status.stopped:
+				sent = true
+			case reply := <-h.replies:
+				if !h.handleReply(ctx, reply) {
+					return false
+				}
+			case err := <-h.errs:
+				h.noteError(err)
+			case <-ctx.Done():
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// adaptReply turns a reply into something its bus can handle, if it asks
+// for something the bus can't do. It returns false if there's nothing left
+// to send.
+func (h *Hub) adaptReply(reply *Reply) bool {
+	bus := h.buses[reply.Bus]
+
+	if _, ok := bus.(ReactionBus); !ok && reply.Reaction != "" {
+		reply.Text = reply.Reaction
+		reply.Reaction = ""
+	}
+
+	if _, ok := bus.(EditBus); !ok && reply.Delete {
+		slog.Debug("dropping delete for bus that can't", "bus", reply.Bus, "ref", reply.Ref)
+		return false
+	}
+
+	return true
+}
+
+// sendLater sends replies to the hub from another goroutine; it's for
+// sending replies from within the io loop, which can't send them itself.
+func (h *Hub) sendLater(ctx context.Context, replies ...Reply) {
+	if len(replies) == 0 {
+		return
+	}
+
+	go func() {
+		for _, reply := range replies {
+			select {
+			case h.replies <- reply:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (h *Hub) forwardReplies(ctx context.Context, name ReactorName, ch <-chan Reply) {
+	counter := h.metrics.replies.WithLabelValues(string(name))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case reply := <-ch:
+			counter.Inc()
+			reply.Reactor = name
+			reply.trace.reactorReplied(name)
+
+			// Replies that didn't come from an event, like ones sent from a
+			// shutdown hook, haven't been counted yet.
+			if reply.inFlight == nil {
+				h.inFlight.Add(1)
+				reply.inFlight = &h.inFlight
+			}
+
+			select {
+			case h.replies <- reply:
+			case <-ctx.Done():
+				return
+			}
 		}
 	}
 }
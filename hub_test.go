@@ -0,0 +1,116 @@
+package marvin_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/mmcclimon/marvin"
+	"github.com/mmcclimon/marvin/marvintest"
+	"github.com/mmcclimon/marvin/registry"
+)
+
+// A reactor that's busy replying mustn't stop the hub from handing it the
+// next event, or the hub waits on the reactor while the reactor waits on the
+// hub.
+func TestBackToBackEvents(t *testing.T) {
+	hub := marvintest.StartHub(t, `
+		[bus.test]
+		type = "marvintest"
+
+		[reactor.echo]
+		type = "echo"
+	`, registry.Known())
+
+	bus := hub.Bus("test")
+
+	for i := 0; i < 50; i++ {
+		bus.Send(fmt.Sprint(i))
+	}
+
+	for i := 0; i < 50; i++ {
+		bus.ExpectReply(fmt.Sprintf("echo: >>> %d <<<", i))
+	}
+
+	if err := hub.Stop(); err != nil {
+		t.Errorf("hub stopped with error: %s", err)
+	}
+}
+
+// grumbler complains about every event before answering it.
+type grumbler struct{}
+
+func (grumbler) Run(ctx context.Context, comm marvin.ReactorBundle) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event := <-comm.Events:
+			event.MarkHandled()
+
+			select {
+			case comm.Errors <- errors.New("not again"):
+			case <-ctx.Done():
+				return nil
+			}
+
+			select {
+			case comm.Replies <- event.Reply("fine: %s", event.Text):
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+func TestBackToBackErrors(t *testing.T) {
+	reg := registry.Known()
+	reg.RegisterReactor("grumbler", func(marvin.ReactorName, map[string]any) (marvin.Reactor, error) {
+		return grumbler{}, nil
+	})
+
+	hub := marvintest.StartHub(t, `
+		[bus.test]
+		type = "marvintest"
+
+		[reactor.grumbler]
+		type = "grumbler"
+	`, reg)
+
+	bus := hub.Bus("test")
+
+	for i := 0; i < 50; i++ {
+		bus.Send(fmt.Sprint(i))
+	}
+
+	for i := 0; i < 50; i++ {
+		bus.ExpectReply(fmt.Sprintf("fine: %d", i))
+	}
+
+	for i := 0; i < 50; i++ {
+		if err := hub.ExpectError(); err.Error() != "not again" {
+			t.Errorf("got error %q, wanted %q", err, "not again")
+		}
+	}
+}
+
+// What a fake bus gets is everything the hub sent, not just its text.
+func TestReplyDetails(t *testing.T) {
+	hub := marvintest.StartHub(t, `
+		[bus.test]
+		type = "marvintest"
+
+		[reactor.echo]
+		type = "echo"
+	`, registry.Known())
+
+	bus := hub.Bus("test")
+	event := bus.Send("hello", marvintest.WithAddress("general"), marvintest.WithMessageID("42"))
+	reply := bus.ExpectReply("echo: >>> hello <<<")
+
+	if reply.Reactor != "echo" || reply.EventID != event.ID() || reply.MessageID != "42" || reply.Address != "general" {
+		t.Errorf("got reply %+v, wanted one from echo in reply to event %d", reply, event.ID())
+	}
+}
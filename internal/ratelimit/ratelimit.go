@@ -0,0 +1,114 @@
+// Package ratelimit provides keyed token buckets.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limit is a token bucket's shape: it holds Burst tokens, and gets a new one
+// back every Every. The zero Limit allows everything.
+type Limit struct {
+	Every time.Duration
+	Burst int
+}
+
+func (l Limit) Unlimited() bool {
+	return l.Every <= 0
+}
+
+func (l Limit) burst() float64 {
+	if l.Burst < 1 {
+		return 1
+	}
+
+	return float64(l.Burst)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Buckets is a set of token buckets with the same limit, one per key. Buckets
+// that have refilled completely are forgotten, since they're no different
+// from ones we've never seen.
+type Buckets struct {
+	limit Limit
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewBuckets(limit Limit) *Buckets {
+	return &Buckets{
+		limit:   limit,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Tokens returns how many tokens key's bucket has at now.
+func (b *Buckets) Tokens(key string, now time.Time) float64 {
+	if b == nil || b.limit.Unlimited() {
+		return 1
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.refill(key, now).tokens
+}
+
+// Take removes a token from key's bucket, if it has one, and reports whether
+// it did.
+func (b *Buckets) Take(key string, now time.Time) bool {
+	if b == nil || b.limit.Unlimited() {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bkt := b.refill(key, now)
+	if bkt.tokens < 1 {
+		return false
+	}
+
+	bkt.tokens--
+	return true
+}
+
+// refill must be called with b.mu held.
+func (b *Buckets) refill(key string, now time.Time) *bucket {
+	b.sweep(now)
+
+	bkt, ok := b.buckets[key]
+	if !ok {
+		bkt = &bucket{tokens: b.limit.burst(), last: now}
+		b.buckets[key] = bkt
+		return bkt
+	}
+
+	elapsed := now.Sub(bkt.last)
+	bkt.last = now
+	bkt.tokens += float64(elapsed) / float64(b.limit.Every)
+	bkt.tokens = min(bkt.tokens, b.limit.burst())
+
+	return bkt
+}
+
+func (b *Buckets) sweep(now time.Time) {
+	full := time.Duration(b.limit.burst() * float64(b.limit.Every))
+	if now.Sub(b.lastSweep) < full {
+		return
+	}
+
+	b.lastSweep = now
+
+	for key, bkt := range b.buckets {
+		if now.Sub(bkt.last) >= full {
+			delete(b.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuckets(t *testing.T) {
+	b := NewBuckets(Limit{Every: time.Second, Burst: 2})
+	now := time.Unix(1_000_000, 0)
+
+	for i := 0; i < 2; i++ {
+		if !b.Take("arthur", now) {
+			t.Fatalf("take %d failed within the burst", i)
+		}
+	}
+
+	if b.Take("arthur", now) {
+		t.Error("took a token past the burst")
+	}
+
+	if !b.Take("ford", now) {
+		t.Error("one key's bucket emptied another's")
+	}
+
+	if got := b.Tokens("arthur", now.Add(500*time.Millisecond)); got != 0.5 {
+		t.Errorf("half a second later, had %v tokens, wanted 0.5", got)
+	}
+
+	if !b.Take("arthur", now.Add(time.Second)) {
+		t.Error("bucket didn't refill")
+	}
+
+	if got := b.Tokens("arthur", now.Add(time.Hour)); got != 2 {
+		t.Errorf("an hour later, had %v tokens, wanted the burst of 2", got)
+	}
+}
+
+func TestBucketsSweep(t *testing.T) {
+	b := NewBuckets(Limit{Every: time.Second, Burst: 1})
+	now := time.Unix(1_000_000, 0)
+
+	b.Take("arthur", now)
+
+	// arthur's full again by the time ford shows up.
+	b.Take("ford", now.Add(1500*time.Millisecond))
+
+	if _, ok := b.buckets["arthur"]; ok {
+		t.Error("full bucket wasn't forgotten")
+	}
+
+	if _, ok := b.buckets["ford"]; !ok {
+		t.Error("partly empty bucket was forgotten")
+	}
+}
+
+func TestUnlimited(t *testing.T) {
+	now := time.Now()
+
+	for _, b := range []*Buckets{nil, NewBuckets(Limit{})} {
+		for i := 0; i < 10; i++ {
+			if !b.Take("arthur", now) {
+				t.Fatalf("unlimited bucket ran out after %d takes", i)
+			}
+		}
+	}
+}
+
+func TestZeroBurst(t *testing.T) {
+	b := NewBuckets(Limit{Every: time.Minute})
+	now := time.Now()
+
+	if !b.Take("arthur", now) {
+		t.Error("a zero burst should still allow one event")
+	}
+
+	if b.Take("arthur", now) {
+		t.Error("a zero burst allowed two events")
+	}
+}
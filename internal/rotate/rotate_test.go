@@ -0,0 +1,98 @@
+package rotate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read %s: %s", path, err)
+	}
+
+	return string(data)
+}
+
+func write(t *testing.T, f *File, lines ...string) {
+	t.Helper()
+
+	for _, line := range lines {
+		if _, err := f.Write([]byte(line + "\n")); err != nil {
+			t.Fatalf("could not write: %s", err)
+		}
+	}
+}
+
+func TestRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	// Each line is 6 bytes, so two fit in a file.
+	f, err := Open(path, 12, 2)
+	if err != nil {
+		t.Fatalf("could not open: %s", err)
+	}
+
+	write(t, f, "line1", "line2", "line3", "line4", "line5", "line6", "line7")
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("could not close: %s", err)
+	}
+
+	for name, want := range map[string]string{
+		path:        "line7\n",
+		path + ".1": "line5\nline6\n",
+		path + ".2": "line3\nline4\n",
+	} {
+		if got := readFile(t, name); got != want {
+			t.Errorf("%s has %q, wanted %q", filepath.Base(name), got, want)
+		}
+	}
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("kept more backups than asked for")
+	}
+}
+
+func TestRotateWithoutBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	f, err := Open(path, 12, 0)
+	if err != nil {
+		t.Fatalf("could not open: %s", err)
+	}
+
+	write(t, f, "line1", "line2", "line3")
+	f.Close()
+
+	if got := readFile(t, path); got != "line3\n" {
+		t.Errorf("log has %q, wanted just the last line", got)
+	}
+
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Errorf("kept a backup without being asked to")
+	}
+}
+
+func TestOpenAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	if err := os.WriteFile(path, []byte("old\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Open(path, 1024, 1)
+	if err != nil {
+		t.Fatalf("could not open: %s", err)
+	}
+
+	write(t, f, "new")
+	f.Close()
+
+	if got := readFile(t, path); got != "old\nnew\n" {
+		t.Errorf("log has %q, wanted the new line appended", got)
+	}
+}
@@ -9,8 +9,17 @@ import (
 var ErrShuttingDown = errors.New("shutting down")
 
 func FromFile(path string, registry Registry) (*Hub, error) {
+	cfg, err := ConfigFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg.Assemble(registry)
+}
+
+func FromString(data string, registry Registry) (*Hub, error) {
 	var cfg Config
-	_, err := toml.DecodeFile(path, &cfg)
+	_, err := toml.Decode(data, &cfg)
 
 	if err != nil {
 		return nil, err
@@ -18,3 +27,14 @@ func FromFile(path string, registry Registry) (*Hub, error) {
 
 	return cfg.Assemble(registry)
 }
+
+func ConfigFromFile(path string) (*Config, error) {
+	var cfg Config
+	_, err := toml.DecodeFile(path, &cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
@@ -0,0 +1,220 @@
+// Package marvintest provides utilities for testing reactors and buses: a
+// fake bus to push events through, helpers to run a single reactor or a
+// whole hub in-process, and ways to check what came back.
+package marvintest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mmcclimon/marvin"
+	"github.com/mmcclimon/marvin/transcript"
+)
+
+// Timeout is how long the Expect* helpers wait for something to happen
+// before failing the test.
+var Timeout = 5 * time.Second
+
+// An EventOption sets extra data on events created by the helpers here.
+type EventOption func(*marvin.Event)
+
+func WithSender(sender string) EventOption {
+	return func(e *marvin.Event) { e.Sender = sender }
+}
+
+func WithAddress(address any) EventOption {
+	return func(e *marvin.Event) { e.Address = address }
+}
+
+func WithDirect() EventOption {
+	return func(e *marvin.Event) { e.Direct = true }
+}
+
+func WithMessageID(id string) EventOption {
+	return func(e *marvin.Event) { e.MessageID = id }
+}
+
+// WithReaction makes the event a reaction to messageID, rather than a
+// message; the event's text should be empty.
+func WithReaction(messageID, emoji string) EventOption {
+	return func(e *marvin.Event) {
+		e.Kind = marvin.KindReaction
+		e.MessageID = messageID
+		e.Reaction = emoji
+	}
+}
+
+// Bus is a fake bus. Events are sent with Send, and anything the hub sends
+// back is captured, to be checked with ExpectReply and friends.
+type Bus struct {
+	t     testing.TB
+	name  marvin.BusName
+	ready chan struct{}
+
+	events  chan<- marvin.Event
+	replies chan marvin.Reply
+
+	mu         sync.Mutex
+	transcript transcript.Transcript
+}
+
+// Enough that a hub sending replies to a bus no one is reading from won't
+// block in any reasonable test.
+const replyBuffer = 1024
+
+func NewBus(t testing.TB, name marvin.BusName) *Bus {
+	return &Bus{
+		t:       t,
+		name:    name,
+		ready:   make(chan struct{}),
+		replies: make(chan marvin.Reply, replyBuffer),
+	}
+}
+
+func (b *Bus) Name() marvin.BusName { return b.name }
+
+func (b *Bus) Run(ctx context.Context, comm marvin.BusBundle) error {
+	b.events = comm.Events
+	close(b.ready)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case reply := <-comm.Replies:
+			b.receive(reply)
+		}
+	}
+}
+
+func (b *Bus) SendMessage(_ context.Context, address any, text string) {
+	b.receive(marvin.Reply{
+		Bus:     b.name,
+		Address: address,
+		Text:    text,
+	})
+}
+
+// receive keeps reply, just as the hub sent it, for ExpectReply.
+func (b *Bus) receive(reply marvin.Reply) {
+	b.record(transcript.Line{FromBot: true, Text: reply.Text})
+	b.replies <- reply
+}
+
+// NewEvent returns an event that looks like it came from this bus, but
+// doesn't send it anywhere.
+func (b *Bus) NewEvent(text string, opts ...EventOption) marvin.Event {
+	evt := marvin.NewEvent(b)
+	evt.Text = text
+
+	for _, opt := range opts {
+		opt(&evt)
+	}
+
+	return evt
+}
+
+// Send makes a new event and sends it to the hub, returning it.
+func (b *Bus) Send(text string, opts ...EventOption) marvin.Event {
+	b.t.Helper()
+
+	evt := b.NewEvent(text, opts...)
+	b.Inject(evt)
+	return evt
+}
+
+// Inject sends an already-built event to the hub.
+func (b *Bus) Inject(evt marvin.Event) {
+	b.t.Helper()
+
+	select {
+	case <-b.ready:
+	case <-time.After(Timeout):
+		b.t.Fatalf("bus %s was never started", b.name)
+	}
+
+	b.record(transcript.Line{Text: evt.Text})
+
+	select {
+	case b.events <- evt:
+	case <-time.After(Timeout):
+		b.t.Fatalf("timed out sending event %q from bus %s", evt.Text, b.name)
+	}
+}
+
+// ExpectReply waits for the next reply, and fails the test if it doesn't
+// arrive or its text isn't want.
+func (b *Bus) ExpectReply(want string) marvin.Reply {
+	b.t.Helper()
+	return expectReply(b.t, b.replies, want)
+}
+
+// ExpectNoReply fails the test if a reply arrives within d.
+func (b *Bus) ExpectNoReply(d time.Duration) {
+	b.t.Helper()
+	expectNoReply(b.t, b.replies, d)
+}
+
+// Transcript returns everything that's been said on the bus so far.
+func (b *Bus) Transcript() transcript.Transcript {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append(transcript.Transcript(nil), b.transcript...)
+}
+
+// ExpectTranscript waits until the bus has seen at least as many lines as
+// are in want (which is parsed with transcript.Parse), then fails the test
+// if the conversation isn't what was expected.
+func (b *Bus) ExpectTranscript(want string) {
+	b.t.Helper()
+
+	expected := transcript.Parse(want)
+	deadline := time.Now().Add(Timeout)
+
+	got := b.Transcript()
+	for len(got) < len(expected) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		got = b.Transcript()
+	}
+
+	if diff := transcript.Diff(expected, got); diff != "" {
+		b.t.Errorf("unexpected transcript (-want +got):\n%s", diff)
+	}
+}
+
+func (b *Bus) record(line transcript.Line) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.transcript = append(b.transcript, line)
+}
+
+func expectReply(t testing.TB, ch <-chan marvin.Reply, want string) marvin.Reply {
+	t.Helper()
+
+	select {
+	case reply := <-ch:
+		if reply.Text != want {
+			t.Errorf("got reply %q, wanted %q", reply.Text, want)
+		}
+
+		return reply
+
+	case <-time.After(Timeout):
+		t.Fatalf("timed out waiting for reply %q", want)
+		return marvin.Reply{}
+	}
+}
+
+func expectNoReply(t testing.TB, ch <-chan marvin.Reply, d time.Duration) {
+	t.Helper()
+
+	select {
+	case reply := <-ch:
+		t.Errorf("got unexpected reply %q", reply.Text)
+	case <-time.After(d):
+	}
+}
@@ -0,0 +1,162 @@
+package marvintest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mmcclimon/marvin"
+)
+
+// BusType is the type name to use for fake buses in configs passed to
+// StartHub.
+const BusType = "marvintest"
+
+// Hub is a full marvin hub running in-process.
+type Hub struct {
+	t        testing.TB
+	registry marvin.Registry
+	buses    map[marvin.BusName]*Bus
+
+	errs   chan error
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// StartHub assembles a hub from the TOML in config, and runs it until the
+// test finishes. Components are looked up in registry, except that buses with
+// type BusType are fake buses, which can be retrieved with Bus. Because the
+// fake bus is provided here, registry may be nil if the config has no
+// reactors or middleware.
+//
+//	hub := marvintest.StartHub(t, `
+//	  [bus.test]
+//	  type = "marvintest"
+//
+//	  [reactor.echo]
+//	  type = "echo"
+//	`, registry.Known())
+//
+//	hub.Bus("test").Send("hello")
+func StartHub(t testing.TB, config string, registry marvin.Registry) *Hub {
+	t.Helper()
+
+	h := &Hub{
+		t:        t,
+		registry: registry,
+		buses:    make(map[marvin.BusName]*Bus),
+		errs:     make(chan error, replyBuffer),
+		done:     make(chan struct{}),
+	}
+
+	hub, err := marvin.FromString(config, h)
+	if err != nil {
+		t.Fatalf("could not assemble hub: %s", err)
+	}
+
+	hub.OnError(func(err error) {
+		select {
+		case h.errs <- err:
+		default:
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+
+	go func() {
+		h.err = hub.RunContext(ctx)
+		close(h.done)
+	}()
+
+	t.Cleanup(func() { h.Stop() })
+
+	return h
+}
+
+// Bus returns the fake bus with the given name, failing the test if there
+// isn't one.
+func (h *Hub) Bus(name marvin.BusName) *Bus {
+	h.t.Helper()
+
+	bus, ok := h.buses[name]
+	if !ok {
+		h.t.Fatalf("no fake bus named %s", name)
+	}
+
+	return bus
+}
+
+// ExpectError waits for a component to report a (non-fatal) error to the
+// hub, and returns it.
+func (h *Hub) ExpectError() error {
+	h.t.Helper()
+
+	select {
+	case err := <-h.errs:
+		return err
+	case <-time.After(Timeout):
+		h.t.Fatal("timed out waiting for error")
+		return nil
+	}
+}
+
+// Stop shuts down the hub and returns whatever error it exited with.
+func (h *Hub) Stop() error {
+	h.t.Helper()
+
+	h.cancel()
+	return h.Wait()
+}
+
+// Wait waits for the hub to exit on its own (say, because a reactor returned
+// an error), and returns the error it exited with.
+func (h *Hub) Wait() error {
+	h.t.Helper()
+
+	select {
+	case <-h.done:
+		return h.err
+	case <-time.After(Timeout):
+		h.t.Fatal("timed out waiting for hub to exit")
+		return nil
+	}
+}
+
+// BusFor, ReactorFor, and MiddlewareFor make Hub a marvin.Registry, which
+// lets us hand out fake buses and delegate everything else.
+
+func (h *Hub) BusFor(typ string) marvin.BusAssembler {
+	if typ == BusType {
+		return h.assembleBus
+	}
+
+	if h.registry == nil {
+		return nil
+	}
+
+	return h.registry.BusFor(typ)
+}
+
+func (h *Hub) ReactorFor(typ string) marvin.ReactorAssembler {
+	if h.registry == nil {
+		return nil
+	}
+
+	return h.registry.ReactorFor(typ)
+}
+
+func (h *Hub) MiddlewareFor(typ string) marvin.MiddlewareAssembler {
+	if h.registry == nil {
+		return nil
+	}
+
+	return h.registry.MiddlewareFor(typ)
+}
+
+func (h *Hub) assembleBus(name marvin.BusName, _ map[string]any) (marvin.Bus, error) {
+	bus := NewBus(h.t, name)
+	h.buses[name] = bus
+	return bus, nil
+}
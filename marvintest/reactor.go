@@ -0,0 +1,119 @@
+package marvintest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mmcclimon/marvin"
+)
+
+// Reactor runs a single reactor without a hub, so that its replies and
+// errors can be checked directly. Events sent this way have no watchdog, so
+// there are no "does not compute" replies; use StartHub to test those.
+type Reactor struct {
+	t       testing.TB
+	bus     *Bus
+	events  chan marvin.Event
+	replies chan marvin.Reply
+	errs    chan error
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// RunReactor starts the reactor, and stops it when the test finishes.
+func RunReactor(t testing.TB, reactor marvin.Reactor) *Reactor {
+	r := &Reactor{
+		t:       t,
+		bus:     NewBus(t, "marvintest"),
+		events:  make(chan marvin.Event),
+		replies: make(chan marvin.Reply, replyBuffer),
+		errs:    make(chan error, replyBuffer),
+		done:    make(chan struct{}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+
+	go func() {
+		r.err = reactor.Run(ctx, marvin.ReactorBundle{
+			Events:  r.events,
+			Replies: r.replies,
+			Errors:  r.errs,
+		})
+
+		close(r.done)
+	}()
+
+	t.Cleanup(func() { r.Stop() })
+
+	return r
+}
+
+// Send makes a new event and hands it to the reactor, returning it.
+func (r *Reactor) Send(text string, opts ...EventOption) marvin.Event {
+	r.t.Helper()
+
+	evt := r.bus.NewEvent(text, opts...)
+
+	select {
+	case r.events <- evt:
+	case <-r.done:
+		r.t.Fatalf("reactor exited before event %q could be sent", text)
+	case <-time.After(Timeout):
+		r.t.Fatalf("timed out sending event %q", text)
+	}
+
+	return evt
+}
+
+// ExpectReply waits for the next reply, and fails the test if it doesn't
+// arrive or its text isn't want.
+func (r *Reactor) ExpectReply(want string) marvin.Reply {
+	r.t.Helper()
+	return expectReply(r.t, r.replies, want)
+}
+
+// ExpectNoReply fails the test if a reply arrives within d.
+func (r *Reactor) ExpectNoReply(d time.Duration) {
+	r.t.Helper()
+	expectNoReply(r.t, r.replies, d)
+}
+
+// ExpectError waits for the reactor to send a (non-fatal) error, and returns
+// it.
+func (r *Reactor) ExpectError() error {
+	r.t.Helper()
+
+	select {
+	case err := <-r.errs:
+		return err
+	case <-time.After(Timeout):
+		r.t.Fatal("timed out waiting for error")
+		return nil
+	}
+}
+
+// Stop cancels the reactor's context and returns whatever it exited with.
+func (r *Reactor) Stop() error {
+	r.t.Helper()
+
+	r.cancel()
+	return r.Wait()
+}
+
+// Wait waits for the reactor to exit on its own, and returns the error it
+// exited with.
+func (r *Reactor) Wait() error {
+	r.t.Helper()
+
+	select {
+	case <-r.done:
+		return r.err
+	case <-time.After(Timeout):
+		r.t.Fatal("timed out waiting for reactor to exit")
+		return nil
+	}
+}
@@ -0,0 +1,108 @@
+package marvin
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+type MetricsConfig struct {
+	// Listen is the address to serve metrics and health checks on (like
+	// "localhost:9100"). If it's empty, metrics are still collected, but
+	// nothing is served.
+	Listen string
+	Path   string
+}
+
+// A MetricsProvider is a bus or reactor with metrics of its own. The hub
+// registers its collectors when it starts the component.
+type MetricsProvider interface {
+	Collectors() []prometheus.Collector
+}
+
+type hubMetrics struct {
+	registry *prometheus.Registry
+
+	eventsReceived    *prometheus.CounterVec
+	dispatchLatency   prometheus.Histogram
+	replies           *prometheus.CounterVec
+	watchdogFired     prometheus.Counter
+	throttled         *prometheus.CounterVec
+	middlewareDropped *prometheus.CounterVec
+	errors            prometheus.Counter
+}
+
+func newHubMetrics() *hubMetrics {
+	m := &hubMetrics{
+		registry: prometheus.NewRegistry(),
+
+		eventsReceived: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "marvin_events_received_total",
+			Help: "Events received from buses.",
+		}, []string{"bus"}),
+
+		dispatchLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "marvin_dispatch_duration_seconds",
+			Help:    "Time taken to hand an event to every reactor.",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 8),
+		}),
+
+		replies: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "marvin_replies_total",
+			Help: "Replies sent by reactors.",
+		}, []string{"reactor"}),
+
+		watchdogFired: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "marvin_watchdog_fired_total",
+			Help: "Events no reactor handled in time, which got a fallback reply.",
+		}),
+
+		throttled: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "marvin_events_throttled_total",
+			Help: "Events dropped for going over a rate limit.",
+		}, []string{"bus", "limit"}),
+
+		middlewareDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "marvin_middleware_dropped_total",
+			Help: "Events and replies dropped by middleware.",
+		}, []string{"middleware", "kind"}),
+
+		errors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "marvin_errors_total",
+			Help: "Non-fatal errors reported by buses and reactors.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.eventsReceived,
+		m.dispatchLatency,
+		m.replies,
+		m.watchdogFired,
+		m.throttled,
+		m.middlewareDropped,
+		m.errors,
+	)
+
+	return m
+}
+
+func (m *hubMetrics) registerComponent(name string, component any) {
+	provider, ok := component.(MetricsProvider)
+	if !ok {
+		return
+	}
+
+	for _, c := range provider.Collectors() {
+		if err := m.registry.Register(c); err != nil {
+			slog.Warn("could not register metrics", "component", name, "err", err)
+		}
+	}
+}
+
+func (m *hubMetrics) observeDispatch(start time.Time) {
+	m.dispatchLatency.Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,72 @@
+package marvin_test
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mmcclimon/marvin/marvintest"
+	"github.com/mmcclimon/marvin/registry"
+)
+
+func TestMetrics(t *testing.T) {
+	addr := freeAddr(t)
+
+	hub := marvintest.StartHub(t, fmt.Sprintf(`
+		[bus.test]
+		type = "marvintest"
+
+		[reactor.echo]
+		type = "echo"
+
+		[metrics]
+		listen = %q
+		path = "/custom-metrics"
+	`, addr), registry.Known())
+
+	bus := hub.Bus("test")
+	bus.Send("hello")
+	bus.ExpectReply("echo: >>> hello <<<")
+
+	code, body := request(t, http.MethodGet, "http://"+addr+"/custom-metrics", "", nil)
+	if code != http.StatusOK {
+		t.Fatalf("got status %d from metrics endpoint", code)
+	}
+
+	for _, want := range []string{
+		`marvin_events_received_total{bus="test"} 1`,
+		`marvin_replies_total{reactor="echo"} 1`,
+		`marvin_watchdog_fired_total 0`,
+		`marvin_dispatch_duration_seconds_count 1`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics don't include %s", want)
+		}
+	}
+}
+
+func TestWatchdogMetric(t *testing.T) {
+	addr := freeAddr(t)
+
+	hub := marvintest.StartHub(t, fmt.Sprintf(`
+		[bus.test]
+		type = "marvintest"
+
+		[reactor.echo]
+		type = "echo"
+
+		[metrics]
+		listen = %q
+	`, addr), registry.Known())
+
+	// echo ignores "ignore", so the watchdog answers instead.
+	bus := hub.Bus("test")
+	bus.Send("ignore")
+	bus.ExpectReply("does not compute")
+
+	_, body := request(t, http.MethodGet, "http://"+addr+"/metrics", "", nil)
+	if !strings.Contains(string(body), "marvin_watchdog_fired_total 1") {
+		t.Errorf("watchdog firing wasn't counted:\n%s", body)
+	}
+}
@@ -0,0 +1,127 @@
+package marvin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+type MiddlewareName string
+
+type MiddlewareAssembler func(MiddlewareName, arbitraryConfig) (Middleware, error)
+
+// Middleware sits between the buses and the reactors, and sees every event
+// on its way in and every reply on its way out. Middleware is configured as
+// an ordered list in the config file:
+//
+//	[[middleware]]
+//	type = "smartquotes"
+//
+//	[[middleware]]
+//	name = "no-bots-channel"
+//	type = "ignore"
+//	addresses = ["1234567890"]
+//
+// Events go through the list in order, and replies in reverse order, so the
+// first middleware sees events first and replies last. Middleware runs on the
+// hub's main loop, so it must not block.
+type Middleware interface {
+	// FilterEvent may modify event. If it returns false, the event is
+	// dropped, and later middleware and reactors never see it. If it returns
+	// a reply (use event.Reply to make one), that reply is sent back to the
+	// bus; returning a reply and false short-circuits the event.
+	FilterEvent(ctx context.Context, event *Event) (*Reply, bool)
+
+	// FilterReply may modify reply. If it returns false, the reply is
+	// dropped.
+	FilterReply(ctx context.Context, reply *Reply) bool
+}
+
+// PassThrough implements Middleware by letting everything through
+// untouched. Embed it in middleware that only cares about events, or only
+// about replies.
+type PassThrough struct{}
+
+func (PassThrough) FilterEvent(context.Context, *Event) (*Reply, bool) { return nil, true }
+func (PassThrough) FilterReply(context.Context, *Reply) bool           { return true }
+
+type namedMiddleware struct {
+	name MiddlewareName
+	Middleware
+}
+
+// filterEvent runs event through the middleware chain. It returns any
+// replies the middleware made along the way, and the name of the middleware
+// that dropped the event, if one did.
+func (h *Hub) filterEvent(ctx context.Context, event *Event) ([]Reply, MiddlewareName) {
+	var replies []Reply
+
+	for _, mw := range h.middleware {
+		reply, ok := mw.FilterEvent(ctx, event)
+		if reply != nil {
+			replies = append(replies, *reply)
+		}
+
+		if !ok {
+			h.metrics.middlewareDropped.WithLabelValues(string(mw.name), "event").Inc()
+			return replies, mw.name
+		}
+	}
+
+	return replies, ""
+}
+
+// filterReply runs reply through the middleware chain, backwards, and
+// reports whether it should be sent.
+func (h *Hub) filterReply(ctx context.Context, reply *Reply) bool {
+	for i := len(h.middleware) - 1; i >= 0; i-- {
+		mw := h.middleware[i]
+		if !mw.FilterReply(ctx, reply) {
+			h.metrics.middlewareDropped.WithLabelValues(string(mw.name), "reply").Inc()
+			return false
+		}
+	}
+
+	return true
+}
+
+func (cfg *Config) assembleMiddleware(hub *Hub, registry Registry) {
+	seen := make(map[string]bool)
+
+	for i, mwConfig := range cfg.Middleware {
+		var id struct{ Name, Type string }
+		if err := mapstructure.Decode(mwConfig, &id); err != nil {
+			cfg.err.add(fmt.Errorf("could not extract name for middleware %d: %w", i, err))
+			continue
+		}
+
+		name := id.Name
+		if name == "" {
+			name = id.Type
+		}
+
+		if seen[name] {
+			cfg.err.add(fmt.Errorf("duplicate middleware '%s'; give one of them a name", name))
+			continue
+		}
+
+		seen[name] = true
+		delete(mwConfig, "name")
+
+		assembler, err := extractAssembler("middleware", name, mwConfig, registry.MiddlewareFor)
+		if err != nil {
+			cfg.err.add(err)
+			continue
+		}
+
+		identifier := MiddlewareName(name)
+		mw, err := assembler(identifier, mwConfig)
+		if err != nil {
+			cfg.err.add(fmt.Errorf("error assembling middleware '%s': %w", name, err))
+			continue
+		}
+
+		hub.middleware = append(hub.middleware, namedMiddleware{identifier, mw})
+	}
+}
@@ -0,0 +1,204 @@
+package marvin_test
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcclimon/marvin"
+	"github.com/mmcclimon/marvin/marvintest"
+	"github.com/mmcclimon/marvin/registry"
+)
+
+// middlewareFuncs is middleware made out of functions; nil ones let
+// everything through.
+type middlewareFuncs struct {
+	event func(*marvin.Event) (*marvin.Reply, bool)
+	reply func(*marvin.Reply) bool
+}
+
+func (m middlewareFuncs) FilterEvent(_ context.Context, event *marvin.Event) (*marvin.Reply, bool) {
+	if m.event == nil {
+		return nil, true
+	}
+
+	return m.event(event)
+}
+
+func (m middlewareFuncs) FilterReply(_ context.Context, reply *marvin.Reply) bool {
+	if m.reply == nil {
+		return true
+	}
+
+	return m.reply(reply)
+}
+
+// withMiddleware returns the known components, plus each of mws registered
+// under its key.
+func withMiddleware(mws map[string]marvin.Middleware) *registry.Registry {
+	reg := registry.Known()
+
+	for name, mw := range mws {
+		mw := mw
+		reg.RegisterMiddleware(name, func(marvin.MiddlewareName, map[string]any) (marvin.Middleware, error) {
+			return mw, nil
+		})
+	}
+
+	return reg
+}
+
+func TestReplyToUnknownBus(t *testing.T) {
+	misdirect := middlewareFuncs{
+		reply: func(reply *marvin.Reply) bool {
+			if strings.Contains(reply.Text, "elsewhere") {
+				reply.Bus = "nowhere"
+			}
+
+			return true
+		},
+	}
+
+	hub := marvintest.StartHub(t, `
+		[bus.test]
+		type = "marvintest"
+
+		[reactor.echo]
+		type = "echo"
+
+		[[middleware]]
+		type = "misdirect"
+	`, withMiddleware(map[string]marvin.Middleware{"misdirect": misdirect}))
+
+	bus := hub.Bus("test")
+
+	bus.Send("send this elsewhere")
+	bus.ExpectNoReply(50 * time.Millisecond)
+
+	bus.Send("hello")
+	bus.ExpectReply("echo: >>> hello <<<")
+}
+
+// tagger marks the events and replies that pass through it, so we can see
+// what order they went in.
+func tagger(tag string) middlewareFuncs {
+	return middlewareFuncs{
+		event: func(event *marvin.Event) (*marvin.Reply, bool) {
+			event.Text += " [" + tag + "]"
+			return nil, true
+		},
+		reply: func(reply *marvin.Reply) bool {
+			reply.Text += " (" + tag + ")"
+			return true
+		},
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	hub := marvintest.StartHub(t, `
+		[bus.test]
+		type = "marvintest"
+
+		[reactor.echo]
+		type = "echo"
+
+		[[middleware]]
+		type = "first"
+
+		[[middleware]]
+		type = "second"
+	`, withMiddleware(map[string]marvin.Middleware{
+		"first":  tagger("1"),
+		"second": tagger("2"),
+	}))
+
+	bus := hub.Bus("test")
+
+	bus.Send("hello")
+	bus.ExpectReply("echo: >>> hello [1] [2] <<< (2) (1)")
+}
+
+func TestMiddlewareDrop(t *testing.T) {
+	var secondSaw []string
+
+	gate := middlewareFuncs{
+		event: func(event *marvin.Event) (*marvin.Reply, bool) {
+			switch event.Text {
+			case "drop me":
+				return nil, false
+			case "ping":
+				reply := event.Reply("pong")
+				return &reply, false
+			}
+
+			return nil, true
+		},
+		reply: func(reply *marvin.Reply) bool {
+			return !strings.Contains(reply.Text, "secret")
+		},
+	}
+
+	// Only ever called from the hub's loop, so there's no need to lock.
+	watcher := middlewareFuncs{
+		event: func(event *marvin.Event) (*marvin.Reply, bool) {
+			secondSaw = append(secondSaw, event.Text)
+			return nil, true
+		},
+	}
+
+	hub := marvintest.StartHub(t, `
+		[bus.test]
+		type = "marvintest"
+
+		[reactor.echo]
+		type = "echo"
+
+		[[middleware]]
+		type = "gate"
+
+		[[middleware]]
+		type = "watcher"
+	`, withMiddleware(map[string]marvin.Middleware{
+		"gate":    gate,
+		"watcher": watcher,
+	}))
+
+	bus := hub.Bus("test")
+
+	// Dropped events don't reach reactors, and don't get "does not
+	// compute" either.
+	bus.Send("drop me")
+	bus.ExpectNoReply(400 * time.Millisecond)
+
+	// Middleware can answer an event itself.
+	bus.Send("ping")
+	bus.ExpectReply("pong")
+
+	bus.Send("a secret")
+	bus.ExpectNoReply(50 * time.Millisecond)
+
+	bus.Send("hello")
+	bus.ExpectReply("echo: >>> hello <<<")
+
+	hub.Stop()
+
+	if want := []string{"a secret", "hello"}; !slices.Equal(secondSaw, want) {
+		t.Errorf("later middleware saw %q, wanted %q", secondSaw, want)
+	}
+}
+
+func TestDuplicateMiddleware(t *testing.T) {
+	_, err := marvin.FromString(`
+		[[middleware]]
+		type = "smartquotes"
+
+		[[middleware]]
+		type = "smartquotes"
+	`, registry.Known())
+
+	if err == nil || !strings.Contains(err.Error(), "duplicate middleware") {
+		t.Errorf("got %v, wanted a duplicate middleware error", err)
+	}
+}
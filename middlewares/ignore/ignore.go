@@ -0,0 +1,60 @@
+package ignore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/mmcclimon/marvin"
+)
+
+// Ignore drops events from the configured senders, addresses (channels, on
+// Discord), and buses.
+type Ignore struct {
+	marvin.PassThrough
+
+	senders   map[string]bool
+	addresses map[string]bool
+	buses     map[marvin.BusName]bool
+}
+
+type config struct {
+	Senders   []string
+	Addresses []string
+	Buses     []string
+}
+
+func Assemble(name marvin.MiddlewareName, rawConfig map[string]any) (marvin.Middleware, error) {
+	var cfg config
+	if err := mapstructure.Decode(rawConfig, &cfg); err != nil {
+		return nil, fmt.Errorf("bad config for %s middleware: %w", name, err)
+	}
+
+	m := &Ignore{
+		senders:   make(map[string]bool),
+		addresses: make(map[string]bool),
+		buses:     make(map[marvin.BusName]bool),
+	}
+
+	for _, s := range cfg.Senders {
+		m.senders[s] = true
+	}
+
+	for _, a := range cfg.Addresses {
+		m.addresses[a] = true
+	}
+
+	for _, b := range cfg.Buses {
+		m.buses[marvin.BusName(b)] = true
+	}
+
+	return m, nil
+}
+
+func (m *Ignore) FilterEvent(_ context.Context, event *marvin.Event) (*marvin.Reply, bool) {
+	ignored := m.senders[event.Sender] ||
+		m.buses[event.SourceBus] ||
+		(event.Address != nil && m.addresses[fmt.Sprint(event.Address)])
+
+	return nil, !ignored
+}
@@ -0,0 +1,64 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/mmcclimon/marvin"
+)
+
+// Logging logs every event and reply that passes through it, at the
+// configured level (info, by default). Where it goes in the middleware list
+// matters: put it first to see everything the buses send, or last to see
+// only what makes it to the reactors.
+type Logging struct {
+	name  marvin.MiddlewareName
+	level slog.Level
+}
+
+type config struct {
+	Level string
+}
+
+func Assemble(name marvin.MiddlewareName, rawConfig map[string]any) (marvin.Middleware, error) {
+	var cfg config
+	if err := mapstructure.Decode(rawConfig, &cfg); err != nil {
+		return nil, fmt.Errorf("bad config for %s middleware: %w", name, err)
+	}
+
+	m := &Logging{name: name, level: slog.LevelInfo}
+
+	if cfg.Level != "" {
+		if err := m.level.UnmarshalText([]byte(cfg.Level)); err != nil {
+			return nil, fmt.Errorf("bad config for %s middleware: %w", name, err)
+		}
+	}
+
+	return m, nil
+}
+
+func (m *Logging) FilterEvent(ctx context.Context, event *marvin.Event) (*marvin.Reply, bool) {
+	slog.Log(ctx, m.level, "event",
+		"middleware", m.name,
+		"id", event.ID(),
+		"bus", event.SourceBus,
+		"sender", event.Sender,
+		"text", event.Text,
+	)
+
+	return nil, true
+}
+
+func (m *Logging) FilterReply(ctx context.Context, reply *marvin.Reply) bool {
+	slog.Log(ctx, m.level, "reply",
+		"middleware", m.name,
+		"event_id", reply.EventID,
+		"bus", reply.Bus,
+		"reactor", reply.Reactor,
+		"text", reply.Text,
+	)
+
+	return true
+}
@@ -0,0 +1,31 @@
+package smartquotes
+
+import (
+	"context"
+	"strings"
+
+	"github.com/mmcclimon/marvin"
+)
+
+// SmartQuotes turns curly quotes in incoming events into straight ones, so
+// that reactors matching on text don't have to care what keyboard (or
+// phone) the sender was using.
+type SmartQuotes struct {
+	marvin.PassThrough
+}
+
+var replacer = strings.NewReplacer(
+	"\u2018", "'", // ‘
+	"\u2019", "'", // ’
+	"\u201c", `"`, // “
+	"\u201d", `"`, // ”
+)
+
+func Assemble(name marvin.MiddlewareName, rawConfig map[string]any) (marvin.Middleware, error) {
+	return &SmartQuotes{}, nil
+}
+
+func (m *SmartQuotes) FilterEvent(_ context.Context, event *marvin.Event) (*marvin.Reply, bool) {
+	event.Text = replacer.Replace(event.Text)
+	return nil, true
+}
@@ -0,0 +1,103 @@
+package wordfilter
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/mmcclimon/marvin"
+)
+
+// WordFilter looks for words from a list in events and replies. What it does
+// when it finds one depends on its action:
+//
+//   - "mask" (the default) replaces the word with asterisks
+//   - "drop" drops the event or reply entirely
+//   - "reply" drops the event, and replies with the configured text instead
+//     (replies containing the word are dropped)
+type WordFilter struct {
+	re     *regexp.Regexp
+	action string
+	reply  string
+}
+
+type config struct {
+	Words  []string
+	Action string
+	Reply  string
+}
+
+func Assemble(name marvin.MiddlewareName, rawConfig map[string]any) (marvin.Middleware, error) {
+	var cfg config
+	if err := mapstructure.Decode(rawConfig, &cfg); err != nil {
+		return nil, fmt.Errorf("bad config for %s middleware: %w", name, err)
+	}
+
+	if len(cfg.Words) == 0 {
+		return nil, fmt.Errorf("bad config for %s middleware: no words to filter", name)
+	}
+
+	switch cfg.Action {
+	case "":
+		cfg.Action = "mask"
+	case "mask", "drop":
+	case "reply":
+		if cfg.Reply == "" {
+			return nil, fmt.Errorf("bad config for %s middleware: reply action needs reply text", name)
+		}
+	default:
+		return nil, fmt.Errorf("bad config for %s middleware: unknown action %q", name, cfg.Action)
+	}
+
+	quoted := make([]string, len(cfg.Words))
+	for i, word := range cfg.Words {
+		quoted[i] = regexp.QuoteMeta(word)
+	}
+
+	return &WordFilter{
+		re:     regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`),
+		action: cfg.Action,
+		reply:  cfg.Reply,
+	}, nil
+}
+
+func (m *WordFilter) FilterEvent(_ context.Context, event *marvin.Event) (*marvin.Reply, bool) {
+	if !m.re.MatchString(event.Text) {
+		return nil, true
+	}
+
+	switch m.action {
+	case "drop":
+		return nil, false
+
+	case "reply":
+		event.MarkHandled()
+		reply := event.Reply("%s", m.reply)
+		return &reply, false
+
+	default:
+		event.Text = m.mask(event.Text)
+		return nil, true
+	}
+}
+
+func (m *WordFilter) FilterReply(_ context.Context, reply *marvin.Reply) bool {
+	if !m.re.MatchString(reply.Text) {
+		return true
+	}
+
+	if m.action == "mask" {
+		reply.Text = m.mask(reply.Text)
+		return true
+	}
+
+	return false
+}
+
+func (m *WordFilter) mask(text string) string {
+	return m.re.ReplaceAllStringFunc(text, func(word string) string {
+		return strings.Repeat("*", len([]rune(word)))
+	})
+}
@@ -0,0 +1,32 @@
+package wordfilter_test
+
+import (
+	"testing"
+
+	"github.com/mmcclimon/marvin/marvintest"
+	"github.com/mmcclimon/marvin/registry"
+)
+
+func TestWordFilterReply(t *testing.T) {
+	hub := marvintest.StartHub(t, `
+		[bus.test]
+		type = "marvintest"
+
+		[reactor.echo]
+		type = "echo"
+
+		[[middleware]]
+		type = "wordfilter"
+		words = ["belgium"]
+		action = "reply"
+		reply = "100% not allowed"
+	`, registry.Known())
+
+	bus := hub.Bus("test")
+
+	bus.Send("oh, belgium")
+	bus.ExpectReply("100% not allowed")
+
+	bus.Send("oh, france")
+	bus.ExpectReply("echo: >>> oh, france <<<")
+}
@@ -0,0 +1,53 @@
+package marvin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Presence is how the bot shows up to people on buses that have such a
+// thing, like Discord's "Watching deploy #123".
+type Presence struct {
+	Status   string // like "online" or "idle"; empty means the bus's default
+	Activity string // like "playing" or "watching"; empty means no activity
+	Text     string
+}
+
+// PresenceBus is a bus that can change the bot's presence. SetPresence may be
+// called from any goroutine.
+type PresenceBus interface {
+	Bus
+	SetPresence(context.Context, Presence) error
+}
+
+var ErrNoPresence = errors.New("bus doesn't support presence")
+
+// Presences lets reactors set the bot's presence on buses that support it:
+//
+//	err := comm.Presences.Set(ctx, "discord", marvin.Presence{
+//		Activity: "watching",
+//		Text:     "deploy #123",
+//	})
+//
+// The zero Presences (which reactors run outside a hub get) doesn't know
+// about any buses.
+type Presences struct {
+	buses map[BusName]Bus
+}
+
+// Set sets the bot's presence on the named bus. It returns ErrNoPresence if
+// the bus doesn't have such a thing.
+func (p Presences) Set(ctx context.Context, bus BusName, presence Presence) error {
+	b, ok := p.buses[bus]
+	if !ok {
+		return fmt.Errorf("no bus named %s", bus)
+	}
+
+	pb, ok := b.(PresenceBus)
+	if !ok {
+		return fmt.Errorf("%s: %w", bus, ErrNoPresence)
+	}
+
+	return pb.SetPresence(ctx, presence)
+}
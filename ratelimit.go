@@ -0,0 +1,204 @@
+package marvin
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/mmcclimon/marvin/internal/ratelimit"
+)
+
+// RateLimitConfig configures flood protection. Each limit is a token bucket:
+// it allows Burst events at once, and one more every Every after that. An
+// event that would go over any of the limits is dropped before it reaches
+// any reactors.
+//
+//	[ratelimit]
+//	per_sender  = { every = "2s", burst = 5 }
+//	per_address = { every = "1s", burst = 10 }
+//	per_bus     = { every = "200ms", burst = 20 }
+//	notice      = "Slow down a little, would you?"
+//	bypass_roles = ["123456789012345678"]
+type RateLimitConfig struct {
+	PerSender  RateLimit `toml:"per_sender"`
+	PerAddress RateLimit `toml:"per_address"`
+	PerBus     RateLimit `toml:"per_bus"`
+
+	// If Notice is set, it's sent as a reply the first time a sender or
+	// address is throttled, and not again until they've cooled down.
+	Notice string
+
+	// Events from these senders, or from senders with any of these roles,
+	// are never throttled.
+	BypassSenders []string `toml:"bypass_senders"`
+	BypassRoles   []string `toml:"bypass_roles"`
+}
+
+const maxNoticed = 10000
+
+type RateLimit struct {
+	Every time.Duration
+	Burst int
+}
+
+type rateLimiter struct {
+	scopes []limitScope
+	notice string
+	bypass map[string]bool
+	roles  map[string]bool
+
+	// keys that have been sent a notice, and haven't been allowed an event
+	// since
+	noticed map[string]bool
+}
+
+type limitScope struct {
+	name    string
+	buckets *ratelimit.Buckets
+	key     func(Event) string
+}
+
+func newRateLimiter(cfg RateLimitConfig) (*rateLimiter, error) {
+	rl := &rateLimiter{
+		notice:  cfg.Notice,
+		bypass:  make(map[string]bool),
+		roles:   make(map[string]bool),
+		noticed: make(map[string]bool),
+	}
+
+	scopes := []struct {
+		name  string
+		limit RateLimit
+		key   func(Event) string
+	}{
+		{"sender", cfg.PerSender, func(e Event) string {
+			return fmt.Sprintf("%s\x00%s", e.SourceBus, e.Sender)
+		}},
+		{"address", cfg.PerAddress, func(e Event) string {
+			return fmt.Sprintf("%s\x00%v", e.SourceBus, e.Address)
+		}},
+		{"bus", cfg.PerBus, func(e Event) string {
+			return string(e.SourceBus)
+		}},
+	}
+
+	for _, s := range scopes {
+		if s.limit.Every < 0 || s.limit.Burst < 0 {
+			return nil, fmt.Errorf("bad per_%s rate limit: every and burst can't be negative", s.name)
+		}
+
+		if s.limit.Every == 0 {
+			continue
+		}
+
+		rl.scopes = append(rl.scopes, limitScope{
+			name:    s.name,
+			buckets: ratelimit.NewBuckets(ratelimit.Limit(s.limit)),
+			key:     s.key,
+		})
+	}
+
+	if len(rl.scopes) == 0 {
+		return nil, nil
+	}
+
+	for _, sender := range cfg.BypassSenders {
+		rl.bypass[sender] = true
+	}
+
+	for _, role := range cfg.BypassRoles {
+		rl.roles[role] = true
+	}
+
+	return rl, nil
+}
+
+// allow reports whether event is within the limits, taking a token from each
+// of its buckets if so. If it isn't, it returns the name of the limit it went
+// over. Tokens are only taken if the event is allowed, so an event that's
+// throttled for one limit doesn't count against the others.
+func (rl *rateLimiter) allow(event Event, now time.Time) (bool, string) {
+	if rl == nil || rl.bypassed(event) {
+		return true, ""
+	}
+
+	for _, s := range rl.scopes {
+		if s.buckets.Tokens(s.key(event), now) < 1 {
+			return false, s.name
+		}
+	}
+
+	for _, s := range rl.scopes {
+		key := s.key(event)
+		s.buckets.Take(key, now)
+		delete(rl.noticed, s.name+"\x00"+key)
+	}
+
+	return true, ""
+}
+
+func (rl *rateLimiter) bypassed(event Event) bool {
+	if rl.bypass[event.Sender] {
+		return true
+	}
+
+	for _, role := range event.Roles {
+		if rl.roles[role] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// shouldNotify reports whether we should tell the sender of event that
+// they've been throttled by the named limit; we only do so once per
+// cooldown.
+func (rl *rateLimiter) shouldNotify(event Event, scope string) bool {
+	if rl.notice == "" || scope == "bus" {
+		return false
+	}
+
+	for _, s := range rl.scopes {
+		if s.name != scope {
+			continue
+		}
+
+		key := s.name + "\x00" + s.key(event)
+		if rl.noticed[key] {
+			return false
+		}
+
+		// Nobody's noticed list should get this long, but if it does,
+		// worst case is some people get told twice.
+		if len(rl.noticed) >= maxNoticed {
+			clear(rl.noticed)
+		}
+
+		rl.noticed[key] = true
+		return true
+	}
+
+	return false
+}
+
+// throttle drops event, after perhaps sending a cooldown notice.
+func (h *Hub) throttle(ctx context.Context, event Event, scope string) {
+	slog.Debug("throttling event",
+		"id", event.ID(),
+		"bus", event.SourceBus,
+		"sender", event.Sender,
+		"limit", scope,
+	)
+
+	h.metrics.throttled.WithLabelValues(string(event.SourceBus), scope).Inc()
+	h.audit.recordThrottled(event, scope)
+
+	if !h.limiter.shouldNotify(event, scope) {
+		event.cancel()
+		return
+	}
+
+	h.sendLater(ctx, event.Reply("%s", h.limiter.notice))
+}
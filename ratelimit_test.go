@@ -0,0 +1,129 @@
+package marvin_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mmcclimon/marvin"
+	"github.com/mmcclimon/marvin/marvintest"
+	"github.com/mmcclimon/marvin/registry"
+)
+
+func TestThrottleNotice(t *testing.T) {
+	hub := marvintest.StartHub(t, `
+		[bus.test]
+		type = "marvintest"
+
+		[reactor.echo]
+		type = "echo"
+
+		[ratelimit]
+		per_sender = { every = "1h", burst = 1 }
+		notice = "slow down, you're at 100% of your quota"
+	`, registry.Known())
+
+	bus := hub.Bus("test")
+
+	bus.Send("one", marvintest.WithSender("arthur"))
+	bus.ExpectReply("echo: >>> one <<<")
+
+	bus.Send("two", marvintest.WithSender("arthur"))
+	bus.ExpectReply("slow down, you're at 100% of your quota")
+
+	// Only once per cooldown.
+	bus.Send("three", marvintest.WithSender("arthur"))
+	bus.ExpectNoReply(50 * time.Millisecond)
+}
+
+func TestRateLimitScopes(t *testing.T) {
+	hub := marvintest.StartHub(t, `
+		[bus.test]
+		type = "marvintest"
+
+		[bus.other]
+		type = "marvintest"
+
+		[reactor.echo]
+		type = "echo"
+
+		[ratelimit]
+		per_address = { every = "1h", burst = 2 }
+		per_bus = { every = "1h", burst = 3 }
+		notice = "shh"
+	`, registry.Known())
+
+	bus := hub.Bus("test")
+	general := marvintest.WithAddress("general")
+	random := marvintest.WithAddress("random")
+
+	bus.Send("one", general, marvintest.WithSender("arthur"))
+	bus.ExpectReply("echo: >>> one <<<")
+
+	// The limit is on the address, not the sender.
+	bus.Send("two", general, marvintest.WithSender("ford"))
+	bus.ExpectReply("echo: >>> two <<<")
+
+	bus.Send("three", general, marvintest.WithSender("zaphod"))
+	bus.ExpectReply("shh")
+
+	// Another address has its own bucket, and the throttled event didn't
+	// take a token from the bus's.
+	bus.Send("four", random)
+	bus.ExpectReply("echo: >>> four <<<")
+
+	// Nobody's told when the whole bus is throttled.
+	bus.Send("five", random)
+	bus.ExpectNoReply(50 * time.Millisecond)
+
+	// Other buses have their own buckets.
+	other := hub.Bus("other")
+	other.Send("six", general)
+	other.ExpectReply("echo: >>> six <<<")
+}
+
+func TestRateLimitBypass(t *testing.T) {
+	hub := marvintest.StartHub(t, `
+		[bus.test]
+		type = "marvintest"
+
+		[reactor.echo]
+		type = "echo"
+
+		[ratelimit]
+		per_bus = { every = "1h", burst = 1 }
+		bypass_senders = ["zaphod"]
+		bypass_roles = ["president"]
+	`, registry.Known())
+
+	bus := hub.Bus("test")
+	withRoles := func(roles ...string) marvintest.EventOption {
+		return func(e *marvin.Event) { e.Roles = roles }
+	}
+
+	bus.Send("one", marvintest.WithSender("arthur"))
+	bus.ExpectReply("echo: >>> one <<<")
+
+	bus.Send("two", marvintest.WithSender("arthur"))
+	bus.ExpectNoReply(50 * time.Millisecond)
+
+	bus.Send("three", marvintest.WithSender("zaphod"))
+	bus.ExpectReply("echo: >>> three <<<")
+
+	bus.Send("four", marvintest.WithSender("trillian"), withRoles("scientist", "president"))
+	bus.ExpectReply("echo: >>> four <<<")
+
+	bus.Send("five", marvintest.WithSender("trillian"), withRoles("scientist"))
+	bus.ExpectNoReply(50 * time.Millisecond)
+}
+
+func TestRateLimitConfig(t *testing.T) {
+	for _, limit := range []string{
+		`per_sender = { every = "-1s", burst = 1 }`,
+		`per_address = { every = "1s", burst = -1 }`,
+	} {
+		_, err := marvin.FromString("[ratelimit]\n"+limit, registry.Known())
+		if err == nil {
+			t.Errorf("assembled a hub with a bad rate limit: %s", limit)
+		}
+	}
+}
@@ -10,6 +10,9 @@ type ReactorBundle struct {
 	Events  <-chan Event
 	Replies chan<- Reply
 	Errors  chan<- error
+
+	Conversations Conversations
+	Presences     Presences
 }
 
 type Reactor interface {
@@ -20,6 +23,17 @@ func (h *Hub) wrapReactorFunc(
 	ctx context.Context,
 	base func(context.Context, ReactorBundle) error,
 	bundle ReactorBundle,
+	status *componentStatus,
 ) func() error {
-	return func() error { return base(ctx, bundle) }
+	return func() error {
+		status.setRunning(true)
+		defer status.exited()
+
+		err := base(ctx, bundle)
+		if err != nil {
+			status.recordError(err)
+		}
+
+		return err
+	}
 }
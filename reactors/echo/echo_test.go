@@ -0,0 +1,63 @@
+package echo_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mmcclimon/marvin/marvintest"
+	"github.com/mmcclimon/marvin/reactors/echo"
+	"github.com/mmcclimon/marvin/registry"
+)
+
+func TestEcho(t *testing.T) {
+	reactor, err := echo.Assemble("echo", map[string]any{})
+	if err != nil {
+		t.Fatalf("could not assemble: %s", err)
+	}
+
+	r := marvintest.RunReactor(t, reactor)
+
+	r.Send("hello")
+	r.ExpectReply("echo: >>> hello <<<")
+
+	r.Send("ignore")
+	r.ExpectNoReply(50 * time.Millisecond)
+}
+
+func TestEchoUpper(t *testing.T) {
+	reactor, err := echo.Assemble("echo", map[string]any{"upper": true})
+	if err != nil {
+		t.Fatalf("could not assemble: %s", err)
+	}
+
+	r := marvintest.RunReactor(t, reactor)
+
+	r.Send("hello")
+	r.ExpectReply("echo: >>> HELLO <<<")
+}
+
+func TestEchoInHub(t *testing.T) {
+	hub := marvintest.StartHub(t, `
+		[bus.test]
+		type = "marvintest"
+
+		[reactor.echo]
+		type = "echo"
+	`, registry.Known())
+
+	bus := hub.Bus("test")
+
+	bus.Send("hello")
+	bus.ExpectReply("echo: >>> hello <<<")
+
+	// nobody handles this, so the watchdog should step in
+	bus.Send("ignore")
+	bus.ExpectReply("does not compute")
+
+	bus.ExpectTranscript(`
+		> hello
+		| echo: >>> hello <<<
+		> ignore
+		| does not compute
+	`)
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"log/slog"
 	"regexp"
-	"time"
 
 	"github.com/mmcclimon/marvin"
 )
@@ -34,7 +33,8 @@ func (r *Eject) Run(ctx context.Context, comm marvin.ReactorBundle) error {
 			event.MarkHandled()
 			comm.Replies <- event.Reply("so long!")
 
-			time.Sleep(2 * time.Second)
+			// The hub drains replies before shutting down, so this one will
+			// get where it's going.
 			return marvin.ErrShuttingDown
 		}
 	}
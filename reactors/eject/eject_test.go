@@ -0,0 +1,30 @@
+package eject_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mmcclimon/marvin"
+	"github.com/mmcclimon/marvin/marvintest"
+	"github.com/mmcclimon/marvin/reactors/eject"
+)
+
+func TestEject(t *testing.T) {
+	reactor, err := eject.Assemble("eject", nil)
+	if err != nil {
+		t.Fatalf("could not assemble: %s", err)
+	}
+
+	r := marvintest.RunReactor(t, reactor)
+
+	r.Send("eject the warp core")
+	r.ExpectNoReply(50 * time.Millisecond)
+
+	r.Send("Eject warp core now")
+	r.ExpectReply("so long!")
+
+	if err := r.Wait(); !errors.Is(err, marvin.ErrShuttingDown) {
+		t.Errorf("got error %v after ejecting, wanted ErrShuttingDown", err)
+	}
+}
@@ -0,0 +1,57 @@
+// Package external is a reactor that hands events off to a separate process,
+// so that reactors can be written in whatever language is handy without
+// recompiling marvin.
+//
+// Configure it like any other reactor:
+//
+//	[reactor.reverse]
+//	type = "external"
+//	command = "/usr/local/bin/reverse.py"
+//	args = ["--shout"]
+//	restart_delay = "5s"  # how long to wait after the plugin dies
+//	reply_timeout = "30s" # how long the plugin has to reply to an event
+//
+// # Protocol
+//
+// The plugin talks to marvin over stdin and stdout. Every message, in either
+// direction, is a single line holding a JSON-RPC 2.0 notification (that is,
+// an object with "jsonrpc", "method" and "params" keys, and no "id"). Nothing
+// expects a response, so a plugin is just a loop that reads a line, decodes
+// it, and maybe writes a line or two. Anything the plugin writes to stderr
+// ends up in marvin's log.
+//
+// Marvin sends one method, once per event seen by the reactor:
+//
+//	{"jsonrpc": "2.0", "method": "event",
+//	 "params": {"id": 12, "kind": "message", "bus": "term", "address": null,
+//	            "sender": "arthur", "text": "hello"}}
+//
+// Kind is "message" unless the reactor has asked for other kinds of event
+// (see the events setting in marvin's reactor config).
+//
+// The plugin can send any of these:
+//
+//	// reply to event 12; this may be sent more than once
+//	{"jsonrpc": "2.0", "method": "reply", "params": {"id": 12, "text": "hi!"}}
+//
+//	// claim event 12 without replying yet; use this when a reply will take
+//	// longer than a moment, so that marvin doesn't say "does not compute"
+//	{"jsonrpc": "2.0", "method": "handled", "params": {"id": 12}}
+//
+//	// report a non-fatal error to the hub
+//	{"jsonrpc": "2.0", "method": "error", "params": {"message": "oh no"}}
+//
+//	// write to marvin's log; level is one of debug, info, warn, or error
+//	{"jsonrpc": "2.0", "method": "log",
+//	 "params": {"level": "info", "message": "starting up", "attrs": {"pid": 1}}}
+//
+// Events the plugin doesn't care about can simply be ignored. When marvin
+// shuts down it closes the plugin's stdin, and the plugin should exit when it
+// sees EOF; if it hasn't within a few seconds, it is killed. If the plugin
+// exits on its own, it is restarted after restart_delay, and events that
+// arrive in the meantime are dropped. Events are also dropped if the plugin
+// falls a hundred events behind in reading them.
+//
+// There is a small reference plugin, written in Python, in
+// testdata/reverse.py.
+package external
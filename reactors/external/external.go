@@ -0,0 +1,306 @@
+package external
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"sync/atomic"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/mmcclimon/marvin"
+)
+
+type External struct {
+	name   marvin.ReactorName
+	logger *slog.Logger
+	config
+
+	// things waiting to go back to the hub; see the comment in run
+	replies []marvin.Reply
+	errs    []error
+
+	alive atomic.Bool
+}
+
+type config struct {
+	Command      string
+	Args         []string
+	Dir          string
+	RestartDelay time.Duration `mapstructure:"restart_delay"`
+	ReplyTimeout time.Duration `mapstructure:"reply_timeout"`
+}
+
+// How many events can be waiting for the plugin to read them before we start
+// dropping them.
+const eventBuffer = 100
+
+type pendingEvent struct {
+	event   marvin.Event
+	expires time.Time
+}
+
+func Assemble(name marvin.ReactorName, rawConfig map[string]any) (marvin.Reactor, error) {
+	cfg := config{
+		RestartDelay: time.Second,
+		ReplyTimeout: 30 * time.Second,
+	}
+
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.StringToTimeDurationHookFunc(),
+		Result:     &cfg,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bad config for %s reactor: %w", name, err)
+	}
+
+	if err := decoder.Decode(rawConfig); err != nil {
+		return nil, fmt.Errorf("bad config for %s reactor: %w", name, err)
+	}
+
+	if cfg.Command == "" {
+		return nil, fmt.Errorf("bad config for %s reactor: no command given", name)
+	}
+
+	return &External{
+		name:   name,
+		logger: slog.Default().With("reactor", name),
+		config: cfg,
+	}, nil
+}
+
+func (r *External) Run(ctx context.Context, comm marvin.ReactorBundle) error {
+	for {
+		err := r.run(ctx, comm)
+		if ctx.Err() != nil {
+			slog.Info("shutting down external reactor")
+			return nil
+		}
+
+		if err == nil {
+			err = errors.New("exited")
+		}
+
+		r.logger.Warn("plugin died, will restart", "err", err, "delay", r.RestartDelay)
+		r.errs = append(r.errs, fmt.Errorf("plugin for reactor %s: %w", r.name, err))
+
+		if !r.waitToRestart(ctx, comm) {
+			slog.Info("shutting down external reactor")
+			return nil
+		}
+	}
+}
+
+// run starts the plugin and shuffles messages back and forth until it exits
+// (or until ctx is cancelled).
+func (r *External) run(ctx context.Context, comm marvin.ReactorBundle) error {
+	cmd := exec.CommandContext(ctx, r.Command, r.Args...)
+	cmd.Dir = r.Dir
+	cmd.Stderr = &logWriter{logger: r.logger}
+	cmd.WaitDelay = 3 * time.Second
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("could not open stdin: %w", err)
+	}
+
+	// On shutdown, we close stdin and give the plugin a chance to exit; after
+	// WaitDelay, it'll be killed.
+	cmd.Cancel = stdin.Close
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("could not open stdout: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("could not start plugin: %w", err)
+	}
+
+	r.logger.Info("started plugin", "command", r.Command, "pid", cmd.Process.Pid)
+
+	r.alive.Store(true)
+	defer r.alive.Store(false)
+
+	msgs := make(chan message)
+	go r.readMessages(stdout, msgs)
+
+	// Writing to the plugin can block, if it's busy writing to us instead of
+	// reading, so that happens on its own, too; otherwise we'd stop reading
+	// what it's written and deadlock.
+	toPlugin := make(chan marvin.Event, eventBuffer)
+	writeErrs := make(chan error)
+	done := make(chan struct{})
+	defer close(done)
+	defer close(toPlugin)
+
+	go writeEvents(stdin, toPlugin, writeErrs, done)
+
+	pending := make(map[uint64]pendingEvent)
+
+	for {
+		// We can't just send replies and errors when we get them: the hub may
+		// well be blocked trying to send us an event, in which case we'd
+		// deadlock. Instead, we queue them, and only offer them up here.
+		replyCh, nextReply, errCh, nextErr := r.outbox(comm)
+
+		select {
+		case <-ctx.Done():
+			// the command's Cancel closes stdin; wait for it to go away
+			for range msgs {
+			}
+
+			_ = cmd.Wait()
+			return nil
+
+		case replyCh <- nextReply:
+			r.replies = r.replies[1:]
+
+		case errCh <- nextErr:
+			r.errs = r.errs[1:]
+
+		case event := <-comm.Events:
+			r.expire(pending)
+
+			select {
+			case toPlugin <- event:
+				pending[event.ID()] = pendingEvent{event, time.Now().Add(r.ReplyTimeout)}
+			default:
+				err := fmt.Errorf("plugin for reactor %s is not keeping up; dropped event %d", r.name, event.ID())
+				r.errs = append(r.errs, err)
+			}
+
+		case err := <-writeErrs:
+			r.errs = append(r.errs, fmt.Errorf("could not send event to plugin: %w", err))
+
+		case msg, ok := <-msgs:
+			if !ok {
+				return cmd.Wait()
+			}
+
+			r.handleMessage(ctx, msg, pending)
+		}
+	}
+}
+
+func (r *External) Healthy() error {
+	if !r.alive.Load() {
+		return errors.New("plugin is not running")
+	}
+
+	return nil
+}
+
+func (r *External) handleMessage(ctx context.Context, msg message, pending map[uint64]pendingEvent) {
+	if msg.err != nil {
+		r.errs = append(r.errs, msg.err)
+		return
+	}
+
+	switch msg.Method {
+	case methodReply, methodHandled:
+		var params replyParams
+		if err := msg.decodeParams(&params); err != nil {
+			r.errs = append(r.errs, err)
+			return
+		}
+
+		p, ok := pending[params.ID]
+		if !ok {
+			r.errs = append(r.errs, fmt.Errorf("plugin sent %s for unknown event %d", msg.Method, params.ID))
+			return
+		}
+
+		p.event.MarkHandled()
+
+		if msg.Method == methodReply {
+			r.replies = append(r.replies, p.event.Reply("%s", params.Text))
+		}
+
+	case methodError:
+		var params errorParams
+		if err := msg.decodeParams(&params); err != nil {
+			r.errs = append(r.errs, err)
+			return
+		}
+
+		r.errs = append(r.errs, fmt.Errorf("plugin for reactor %s: %s", r.name, params.Message))
+
+	case methodLog:
+		var params logParams
+		if err := msg.decodeParams(&params); err != nil {
+			r.errs = append(r.errs, err)
+			return
+		}
+
+		attrs := make([]any, 0, 2*len(params.Attrs))
+		for k, v := range params.Attrs {
+			attrs = append(attrs, k, v)
+		}
+
+		r.logger.Log(ctx, params.level(), params.Message, attrs...)
+
+	default:
+		r.errs = append(r.errs, fmt.Errorf("plugin sent unknown method %q", msg.Method))
+	}
+}
+
+func (r *External) expire(pending map[uint64]pendingEvent) {
+	now := time.Now()
+
+	for id, p := range pending {
+		if now.After(p.expires) {
+			delete(pending, id)
+		}
+	}
+}
+
+// waitToRestart waits out the restart delay, dropping events on the floor
+// while it does. It returns false if we should shut down instead.
+func (r *External) waitToRestart(ctx context.Context, comm marvin.ReactorBundle) bool {
+	timer := time.NewTimer(r.RestartDelay)
+	defer timer.Stop()
+
+	for {
+		replyCh, nextReply, errCh, nextErr := r.outbox(comm)
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-timer.C:
+			return true
+		case replyCh <- nextReply:
+			r.replies = r.replies[1:]
+		case errCh <- nextErr:
+			r.errs = r.errs[1:]
+		case event := <-comm.Events:
+			r.logger.Debug("dropping event while plugin is down", "id", event.ID())
+		}
+	}
+}
+
+// outbox returns the channels to offer queued replies and errors on, along
+// with the next value for each. The channels are nil (and so block forever in
+// a select) if there's nothing queued.
+func (r *External) outbox(comm marvin.ReactorBundle) (
+	chan<- marvin.Reply, marvin.Reply,
+	chan<- error, error,
+) {
+	var replyCh chan<- marvin.Reply
+	var nextReply marvin.Reply
+	if len(r.replies) > 0 {
+		replyCh = comm.Replies
+		nextReply = r.replies[0]
+	}
+
+	var errCh chan<- error
+	var nextErr error
+	if len(r.errs) > 0 {
+		errCh = comm.Errors
+		nextErr = r.errs[0]
+	}
+
+	return replyCh, nextReply, errCh, nextErr
+}
@@ -0,0 +1,205 @@
+package external
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcclimon/marvin"
+)
+
+type fakeBus struct{}
+
+func (fakeBus) Name() marvin.BusName                        { return "test" }
+func (fakeBus) Run(context.Context, marvin.BusBundle) error { return nil }
+func (fakeBus) SendMessage(context.Context, any, string)    {}
+
+func TestReferencePlugin(t *testing.T) {
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("python3 not available")
+	}
+
+	reactor, err := Assemble("reverse", map[string]any{
+		"command":       python,
+		"args":          []any{"testdata/reverse.py"},
+		"restart_delay": "10ms",
+	})
+	if err != nil {
+		t.Fatalf("could not assemble: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan marvin.Event)
+	replies := make(chan marvin.Reply)
+	errs := make(chan error, 10)
+
+	done := make(chan error)
+	go func() {
+		done <- reactor.Run(ctx, marvin.ReactorBundle{
+			Events:  events,
+			Replies: replies,
+			Errors:  errs,
+		})
+	}()
+
+	send := func(text string) marvin.Event {
+		evt := marvin.NewEvent(fakeBus{})
+		evt.Text = text
+		evt.Sender = "arthur"
+		events <- evt
+		return evt
+	}
+
+	expectReply := func(text string) {
+		t.Helper()
+
+		select {
+		case reply := <-replies:
+			if reply.Text != text {
+				t.Errorf("got reply %q, wanted %q", reply.Text, text)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for reply %q", text)
+		}
+	}
+
+	send("reverse hello")
+	expectReply("olleh")
+
+	send("slow abc")
+	expectReply("cba")
+
+	send("whoami")
+	expectReply("arthur sent a message")
+
+	send("crash")
+
+	select {
+	case <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no error after plugin crashed")
+	}
+
+	// Events are dropped while the plugin restarts, so keep trying until it's
+	// back.
+	deadline := time.After(5 * time.Second)
+	for restarted := false; !restarted; {
+		send("reverse again")
+
+		select {
+		case reply := <-replies:
+			if reply.Text != "niaga" {
+				t.Fatalf("got reply %q after restart", reply.Text)
+			}
+			restarted = true
+		case <-time.After(100 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("plugin never came back after crash")
+		}
+	}
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("got error on shutdown: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reactor did not shut down")
+	}
+}
+
+// A plugin busy writing to us isn't reading what we write to it, and we
+// mustn't wait for it to do so, or we'll stop reading and it'll never finish.
+func TestFloodingPlugin(t *testing.T) {
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("python3 not available")
+	}
+
+	reactor, err := Assemble("flood", map[string]any{
+		"command": python,
+		"args":    []any{"testdata/flood.py"},
+	})
+	if err != nil {
+		t.Fatalf("could not assemble: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan marvin.Event)
+	replies := make(chan marvin.Reply)
+	errs := make(chan error)
+
+	done := make(chan error)
+	go func() {
+		done <- reactor.Run(ctx, marvin.ReactorBundle{
+			Events:  events,
+			Replies: replies,
+			Errors:  errs,
+		})
+	}()
+
+	const n = 1000
+
+	go func() {
+		for i := 0; i <= n; i++ {
+			evt := marvin.NewEvent(fakeBus{})
+			evt.Text = "hello"
+			if i == 0 {
+				evt.Text = "flood"
+			}
+
+			select {
+			case events <- evt:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// Every event gets a reply unless it's dropped, and we hear about it if
+	// it is.
+	var flooded, answered, dropped int
+	timeout := time.After(10 * time.Second)
+
+	for flooded < 1000 || answered+dropped < n {
+		select {
+		case reply := <-replies:
+			if reply.Text == "ok" {
+				answered++
+			} else {
+				flooded++
+			}
+
+		case err := <-errs:
+			if !strings.Contains(err.Error(), "not keeping up") {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			dropped++
+
+		case <-timeout:
+			t.Fatalf("stuck after %d flood replies, %d answers, and %d dropped events",
+				flooded, answered, dropped)
+		}
+	}
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("got error on shutdown: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reactor did not shut down")
+	}
+}
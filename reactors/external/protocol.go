@@ -0,0 +1,166 @@
+package external
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/mmcclimon/marvin"
+)
+
+const (
+	methodEvent   = "event"
+	methodReply   = "reply"
+	methodHandled = "handled"
+	methodError   = "error"
+	methodLog     = "log"
+)
+
+// Plugins may send long lines (big replies, for instance), so allow for more
+// than bufio's default.
+const maxLineSize = 1024 * 1024
+
+type notification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+type eventParams struct {
+	ID      uint64         `json:"id"`
+	Kind    string         `json:"kind"`
+	Bus     marvin.BusName `json:"bus"`
+	Address any            `json:"address"`
+	Sender  string         `json:"sender"`
+	Text    string         `json:"text"`
+}
+
+// message is something we got from the plugin; if we couldn't make sense of
+// the line at all, err is set.
+type message struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	err    error
+}
+
+type replyParams struct {
+	ID   uint64 `json:"id"`
+	Text string `json:"text"`
+}
+
+type errorParams struct {
+	Message string `json:"message"`
+}
+
+type logParams struct {
+	Level   string         `json:"level"`
+	Message string         `json:"message"`
+	Attrs   map[string]any `json:"attrs"`
+}
+
+func (m message) decodeParams(v any) error {
+	if err := json.Unmarshal(m.Params, v); err != nil {
+		return fmt.Errorf("bad params for %s from plugin: %w", m.Method, err)
+	}
+
+	return nil
+}
+
+func (p logParams) level() slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(p.Level)); err != nil {
+		return slog.LevelInfo
+	}
+
+	return level
+}
+
+func writeEvent(w io.Writer, event marvin.Event) error {
+	data, err := json.Marshal(notification{
+		JSONRPC: "2.0",
+		Method:  methodEvent,
+		Params: eventParams{
+			ID:      event.ID(),
+			Kind:    event.Kind.String(),
+			Bus:     event.SourceBus,
+			Address: event.Address,
+			Sender:  event.Sender,
+			Text:    event.Text,
+		},
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// writeEvents writes events to the plugin until the channel is closed,
+// sending back any errors, until done is closed.
+func writeEvents(stdin io.Writer, events <-chan marvin.Event, errs chan<- error, done <-chan struct{}) {
+	for event := range events {
+		if err := writeEvent(stdin, event); err != nil {
+			select {
+			case errs <- err:
+			case <-done:
+				return
+			}
+		}
+	}
+}
+
+// readMessages reads lines from the plugin until EOF, then closes the
+// channel.
+func (r *External) readMessages(stdout io.Reader, msgs chan<- message) {
+	defer close(msgs)
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(nil, maxLineSize)
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var msg message
+		if err := json.Unmarshal(line, &msg); err != nil {
+			msg.err = fmt.Errorf("bad line from plugin: %w", err)
+		}
+
+		msgs <- msg
+	}
+
+	if err := scanner.Err(); err != nil {
+		msgs <- message{err: fmt.Errorf("error reading from plugin: %w", err)}
+	}
+}
+
+// logWriter sends the plugin's stderr to our log, a line at a time.
+type logWriter struct {
+	logger *slog.Logger
+	buf    []byte
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		line := strings.TrimRight(string(w.buf[:i]), "\r")
+		w.buf = w.buf[i+1:]
+		w.logger.Info("plugin stderr", "line", line)
+	}
+
+	return len(p), nil
+}
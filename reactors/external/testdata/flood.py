@@ -0,0 +1,30 @@
+#!/usr/bin/env python3
+"""A plugin that says a lot more than it listens.
+
+It replies to "flood" with a thousand long replies, all written before it
+reads anything else, and to everything else with "ok".
+"""
+
+import json
+import sys
+
+
+def send(method, **params):
+    msg = {"jsonrpc": "2.0", "method": method, "params": params}
+    sys.stdout.write(json.dumps(msg) + "\n")
+    sys.stdout.flush()
+
+
+def main():
+    for line in sys.stdin:
+        event = json.loads(line)["params"]
+
+        if event["text"] == "flood":
+            for _ in range(1000):
+                send("reply", id=event["id"], text="x" * 1000)
+        else:
+            send("reply", id=event["id"], text="ok")
+
+
+if __name__ == "__main__":
+    main()
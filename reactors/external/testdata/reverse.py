@@ -0,0 +1,50 @@
+#!/usr/bin/env python3
+"""A reference plugin for marvin's external reactor.
+
+It replies to "reverse <text>" with the text backwards, to "slow <text>" by
+claiming the event and replying after a short pause, and to "whoami" with
+who sent it and what kind of event it was. Everything else is ignored. See
+the package documentation for reactors/external for the protocol.
+"""
+
+import json
+import sys
+import time
+
+
+def send(method, **params):
+    msg = {"jsonrpc": "2.0", "method": method, "params": params}
+    sys.stdout.write(json.dumps(msg) + "\n")
+    sys.stdout.flush()
+
+
+def main():
+    send("log", level="info", message="reverse plugin starting")
+
+    for line in sys.stdin:
+        try:
+            msg = json.loads(line)
+        except ValueError as e:
+            send("error", message=f"bad line from marvin: {e}")
+            continue
+
+        if msg.get("method") != "event":
+            continue
+
+        event = msg["params"]
+        command, _, rest = event["text"].partition(" ")
+
+        if command == "reverse":
+            send("reply", id=event["id"], text=rest[::-1])
+        elif command == "slow":
+            send("handled", id=event["id"])
+            time.sleep(0.5)
+            send("reply", id=event["id"], text=rest[::-1])
+        elif command == "whoami":
+            send("reply", id=event["id"], text=f"{event['sender']} sent a {event['kind']}")
+        elif command == "crash":
+            sys.exit(1)
+
+
+if __name__ == "__main__":
+    main()
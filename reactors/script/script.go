@@ -0,0 +1,351 @@
+// Package script is a reactor that runs small Starlark scripts, for commands
+// that aren't worth writing a whole reactor for.
+//
+//	[reactor.scripts]
+//	type = "script"
+//	dir = "/etc/marvin/scripts"
+//	max_steps = 100000      # per script, per event; roughly a CPU limit
+//	timeout = "200ms"       # per event, for all the scripts; a wall-clock limit
+//	reload_interval = "2s"  # how often to check dir for changes
+//
+// Every file in dir ending in .star is loaded, and must define a function
+// called react, which is called with every event. The event has the fields
+// text, sender, and bus; scripts reply by calling the builtin reply function,
+// which takes a string. A script that wants to ignore an event just doesn't
+// call reply. For example:
+//
+//	def react(event):
+//	    if event.text.startswith("shout "):
+//	        reply(event.text.removeprefix("shout ").upper() + "!")
+//
+// Scripts have no access to the filesystem, network, or each other, and
+// cannot keep state between invocations. They're reloaded when their files
+// change; if a changed script doesn't compile, the old version is kept.
+//
+// Scripts run one after another, and share the timeout: if the first one
+// takes all of it, the rest don't run at all. The hub says "does not
+// compute" to messages nobody has answered after a quarter of a second, so
+// keep timeout under that. An event counts as answered as soon as any script
+// calls reply, however long it takes to finish.
+package script
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/mmcclimon/marvin"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+const invocationKey = "marvin.invocation"
+
+type Script struct {
+	name    marvin.ReactorName
+	logger  *slog.Logger
+	scripts map[string]*compiled
+	config
+
+	// things waiting to go back to the hub; see the comment in Run
+	replies []marvin.Reply
+	errs    []error
+}
+
+// invocation is a script's turn at an event.
+type invocation struct {
+	event   *marvin.Event
+	replies []string
+}
+
+type config struct {
+	Dir            string
+	MaxSteps       uint64        `mapstructure:"max_steps"`
+	Timeout        time.Duration `mapstructure:"timeout"`
+	ReloadInterval time.Duration `mapstructure:"reload_interval"`
+}
+
+type compiled struct {
+	path    string
+	modTime time.Time
+	react   starlark.Callable
+}
+
+func Assemble(name marvin.ReactorName, rawConfig map[string]any) (marvin.Reactor, error) {
+	cfg := config{
+		MaxSteps:       100_000,
+		Timeout:        200 * time.Millisecond,
+		ReloadInterval: 2 * time.Second,
+	}
+
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.StringToTimeDurationHookFunc(),
+		Result:     &cfg,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bad config for %s reactor: %w", name, err)
+	}
+
+	if err := decoder.Decode(rawConfig); err != nil {
+		return nil, fmt.Errorf("bad config for %s reactor: %w", name, err)
+	}
+
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("bad config for %s reactor: no dir given", name)
+	}
+
+	return &Script{
+		name:    name,
+		logger:  slog.Default().With("reactor", name),
+		scripts: make(map[string]*compiled),
+		config:  cfg,
+	}, nil
+}
+
+func (r *Script) Run(ctx context.Context, comm marvin.ReactorBundle) error {
+	// Script errors, even at startup, aren't fatal: they can be fixed while
+	// we're running.
+	if err := r.reload(); err != nil {
+		r.errs = append(r.errs, err)
+	}
+
+	ticker := time.NewTicker(r.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		// We can't just send replies and errors when we get them: the hub may
+		// well be blocked trying to send us an event, in which case we'd
+		// deadlock. Instead, we queue them, and only offer them up here.
+		replyCh, nextReply, errCh, nextErr := r.outbox(comm)
+
+		select {
+		case <-ctx.Done():
+			r.logger.Info("shutting down script reactor")
+			return nil
+
+		case replyCh <- nextReply:
+			r.replies = r.replies[1:]
+
+		case errCh <- nextErr:
+			r.errs = r.errs[1:]
+
+		case <-ticker.C:
+			if err := r.reload(); err != nil {
+				r.errs = append(r.errs, err)
+			}
+
+		case event := <-comm.Events:
+			r.react(event)
+		}
+	}
+}
+
+// react runs every script on event, one after another, until they're done
+// or the timeout passes.
+func (r *Script) react(event marvin.Event) {
+	deadline := time.Now().Add(r.Timeout)
+
+	for _, path := range r.sortedPaths() {
+		if time.Now().After(deadline) {
+			r.errs = append(r.errs, fmt.Errorf("no time left to run %s", path))
+			continue
+		}
+
+		r.runScript(r.scripts[path], &event, deadline)
+	}
+}
+
+func (r *Script) sortedPaths() []string {
+	paths := make([]string, 0, len(r.scripts))
+	for path := range r.scripts {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+	return paths
+}
+
+func (r *Script) runScript(script *compiled, event *marvin.Event, deadline time.Time) {
+	inv := &invocation{event: event}
+
+	thread := r.newThread(script.path)
+	thread.SetLocal(invocationKey, inv)
+
+	timer := time.AfterFunc(time.Until(deadline), func() {
+		thread.Cancel("timed out")
+	})
+	defer timer.Stop()
+
+	arg := starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"text":   starlark.String(event.Text),
+		"sender": starlark.String(event.Sender),
+		"bus":    starlark.String(event.SourceBus),
+	})
+
+	_, err := starlark.Call(thread, script.react, starlark.Tuple{arg}, nil)
+	if err != nil {
+		r.errs = append(r.errs, fmt.Errorf("error running %s: %w", script.path, err))
+	}
+
+	// If the script replied before it failed, we send those along anyway.
+	for _, text := range inv.replies {
+		r.replies = append(r.replies, event.Reply("%s", text))
+	}
+}
+
+// outbox returns the channels to offer queued replies and errors on, along
+// with the next value for each. The channels are nil (and so block forever in
+// a select) if there's nothing queued.
+func (r *Script) outbox(comm marvin.ReactorBundle) (
+	chan<- marvin.Reply, marvin.Reply,
+	chan<- error, error,
+) {
+	var replyCh chan<- marvin.Reply
+	var nextReply marvin.Reply
+	if len(r.replies) > 0 {
+		replyCh = comm.Replies
+		nextReply = r.replies[0]
+	}
+
+	var errCh chan<- error
+	var nextErr error
+	if len(r.errs) > 0 {
+		errCh = comm.Errors
+		nextErr = r.errs[0]
+	}
+
+	return replyCh, nextReply, errCh, nextErr
+}
+
+func (r *Script) newThread(path string) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: filepath.Base(path),
+		Print: func(_ *starlark.Thread, msg string) {
+			r.logger.Info("script output", "script", path, "msg", msg)
+		},
+	}
+
+	thread.SetMaxExecutionSteps(r.MaxSteps)
+	return thread
+}
+
+// reload compiles any scripts that are new or have changed since we last
+// looked, and forgets about any that have gone away.
+func (r *Script) reload() error {
+	entries, err := os.ReadDir(r.Dir)
+	if err != nil {
+		return fmt.Errorf("could not read script dir: %w", err)
+	}
+
+	var errs []error
+	seen := make(map[string]bool)
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".star") {
+			continue
+		}
+
+		path := filepath.Join(r.Dir, entry.Name())
+		seen[path] = true
+
+		info, err := entry.Info()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		old, ok := r.scripts[path]
+		if ok && old.modTime.Equal(info.ModTime()) {
+			continue
+		}
+
+		script, err := r.compile(path, info.ModTime())
+		if err != nil {
+			if ok {
+				// don't keep trying to compile it until it changes again
+				old.modTime = info.ModTime()
+			}
+
+			errs = append(errs, err)
+			continue
+		}
+
+		r.logger.Info("loaded script", "path", path)
+		r.scripts[path] = script
+	}
+
+	for path := range r.scripts {
+		if !seen[path] {
+			r.logger.Info("unloaded script", "path", path)
+			delete(r.scripts, path)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (r *Script) compile(path string, modTime time.Time) (*compiled, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", path, err)
+	}
+
+	thread := r.newThread(path)
+
+	timer := time.AfterFunc(r.Timeout, func() {
+		thread.Cancel("timed out")
+	})
+	defer timer.Stop()
+
+	globals, err := starlark.ExecFile(thread, path, src, predeclared)
+	if err != nil {
+		return nil, fmt.Errorf("could not load %s: %w", path, err)
+	}
+
+	react, ok := globals["react"].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("script %s does not define a react function", path)
+	}
+
+	return &compiled{
+		path:    path,
+		modTime: modTime,
+		react:   react,
+	}, nil
+}
+
+var predeclared = starlark.StringDict{
+	"reply":  starlark.NewBuiltin("reply", reply),
+	"struct": starlark.NewBuiltin("struct", starlarkstruct.Make),
+}
+
+func reply(
+	thread *starlark.Thread,
+	b *starlark.Builtin,
+	args starlark.Tuple,
+	kwargs []starlark.Tuple,
+) (starlark.Value, error) {
+	var text string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &text); err != nil {
+		return nil, err
+	}
+
+	inv, ok := thread.Local(invocationKey).(*invocation)
+	if !ok {
+		return nil, fmt.Errorf("%s: can only be called from react", b.Name())
+	}
+
+	// The reply won't go anywhere until the script's finished, but it's
+	// been answered, so there's no call for "does not compute" in the
+	// meantime.
+	inv.event.MarkHandled()
+	inv.replies = append(inv.replies, text)
+	return starlark.None, nil
+}
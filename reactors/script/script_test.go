@@ -0,0 +1,276 @@
+package script_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcclimon/marvin/marvintest"
+	"github.com/mmcclimon/marvin/reactors/script"
+	"github.com/mmcclimon/marvin/registry"
+)
+
+const shout = `
+def react(event):
+    if event.text.startswith("shout "):
+        reply(event.text.removeprefix("shout ").upper() + "!")
+`
+
+// writeScript writes a script into dir, with a modification time of at, so
+// that the reactor can tell it's changed no matter how quickly we rewrite
+// it.
+func writeScript(t *testing.T, dir, name, src string, at time.Time) {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatalf("could not write script: %s", err)
+	}
+
+	if err := os.Chtimes(path, at, at); err != nil {
+		t.Fatalf("could not set script's mtime: %s", err)
+	}
+}
+
+func runScripts(t *testing.T, config map[string]any) *marvintest.Reactor {
+	t.Helper()
+
+	reactor, err := script.Assemble("scripts", config)
+	if err != nil {
+		t.Fatalf("could not assemble: %s", err)
+	}
+
+	return marvintest.RunReactor(t, reactor)
+}
+
+func expectError(t *testing.T, r *marvintest.Reactor, want string) {
+	t.Helper()
+
+	if err := r.ExpectError(); !strings.Contains(err.Error(), want) {
+		t.Errorf("got error %q, wanted one mentioning %q", err, want)
+	}
+}
+
+func TestScript(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	writeScript(t, dir, "a.star", shout, now)
+	writeScript(t, dir, "b.star", `
+def react(event):
+    if event.text.startswith("shout "):
+        reply("%s, please use your indoor voice on %s" % (event.sender, event.bus))
+`, now)
+	writeScript(t, dir, "notes.txt", "not a script", now)
+
+	r := runScripts(t, map[string]any{"dir": dir})
+
+	r.Send("shout hello", marvintest.WithSender("arthur"))
+	r.ExpectReply("HELLO!")
+	r.ExpectReply("arthur, please use your indoor voice on marvintest")
+
+	r.Send("hello")
+	r.ExpectNoReply(50 * time.Millisecond)
+}
+
+func TestScriptLimits(t *testing.T) {
+	dir := t.TempDir()
+
+	writeScript(t, dir, "spin.star", `
+def react(event):
+    reply("thinking")
+    for i in range(1000000000):
+        pass
+`, time.Now())
+
+	t.Run("steps", func(t *testing.T) {
+		r := runScripts(t, map[string]any{"dir": dir, "max_steps": 1000, "timeout": "1m"})
+
+		r.Send("hello")
+		expectError(t, r, "too many steps")
+
+		// Replies from before it failed are still sent.
+		r.ExpectReply("thinking")
+	})
+
+	t.Run("time", func(t *testing.T) {
+		r := runScripts(t, map[string]any{"dir": dir, "max_steps": 1 << 62, "timeout": "50ms"})
+
+		r.Send("hello")
+		expectError(t, r, "timed out")
+		r.ExpectReply("thinking")
+	})
+}
+
+func TestScriptSharedTimeout(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	writeScript(t, dir, "a.star", `
+def react(event):
+    reply("a")
+    for i in range(1000000000):
+        pass
+`, now)
+	writeScript(t, dir, "b.star", `
+def react(event):
+    reply("b")
+`, now)
+
+	r := runScripts(t, map[string]any{"dir": dir, "max_steps": 1 << 62, "timeout": "100ms"})
+
+	// The first script uses up all the time, so the second doesn't get a
+	// turn.
+	r.Send("hello")
+	expectError(t, r, "timed out")
+	expectError(t, r, "no time left to run "+filepath.Join(dir, "b.star"))
+
+	r.ExpectReply("a")
+	r.ExpectNoReply(50 * time.Millisecond)
+}
+
+func TestScriptReload(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	writeScript(t, dir, "shout.star", shout, now)
+
+	r := runScripts(t, map[string]any{"dir": dir, "reload_interval": "10ms"})
+
+	r.Send("shout hello")
+	r.ExpectReply("HELLO!")
+
+	// A new version replaces the old.
+	writeScript(t, dir, "shout.star", strings.ReplaceAll(shout, `"!"`, `"!!!"`), now.Add(time.Second))
+	time.Sleep(100 * time.Millisecond)
+
+	r.Send("shout hello")
+	r.ExpectReply("HELLO!!!")
+
+	// A broken one doesn't, and we only hear about it once.
+	writeScript(t, dir, "shout.star", "def react(event):\n    reply(", now.Add(2*time.Second))
+	expectError(t, r, "could not load")
+
+	r.Send("shout hello")
+	r.ExpectReply("HELLO!!!")
+
+	// A script without a react function is broken, too.
+	writeScript(t, dir, "lazy.star", "x = 1\n", now)
+	expectError(t, r, "does not define a react function")
+
+	// Deleting a script unloads it.
+	if err := os.Remove(filepath.Join(dir, "shout.star")); err != nil {
+		t.Fatalf("could not remove script: %s", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	r.Send("shout hello")
+	r.ExpectNoReply(50 * time.Millisecond)
+}
+
+func TestScriptErrorAtStartup(t *testing.T) {
+	dir := t.TempDir()
+
+	writeScript(t, dir, "broken.star", "def react(event:\n", time.Now())
+	writeScript(t, dir, "shout.star", shout, time.Now())
+
+	r := runScripts(t, map[string]any{"dir": dir})
+	expectError(t, r, "could not load")
+
+	// The scripts that did load still run.
+	r.Send("shout hello")
+	r.ExpectReply("HELLO!")
+}
+
+func TestScriptConfig(t *testing.T) {
+	if _, err := script.Assemble("scripts", map[string]any{}); err == nil {
+		t.Error("assembled a script reactor without a dir")
+	}
+
+	if _, err := script.Assemble("scripts", map[string]any{"dir": "/tmp", "timeout": "soon"}); err == nil {
+		t.Error("assembled a script reactor with a bad timeout")
+	}
+}
+
+func TestScriptInHub(t *testing.T) {
+	dir := t.TempDir()
+	writeScript(t, dir, "shout.star", shout, time.Now())
+
+	hub := marvintest.StartHub(t, fmt.Sprintf(`
+		[bus.test]
+		type = "marvintest"
+
+		[reactor.scripts]
+		type = "script"
+		dir = %q
+	`, dir), registry.Known())
+
+	bus := hub.Bus("test")
+
+	bus.Send("shout hello")
+	bus.ExpectReply("HELLO!")
+
+	bus.Send("hello")
+	bus.ExpectReply("does not compute")
+}
+
+func TestScriptRepliesEarly(t *testing.T) {
+	dir := t.TempDir()
+	writeScript(t, dir, "ponder.star", `
+def react(event):
+    reply("let me think about that")
+    for i in range(1000000000):
+        pass
+`, time.Now())
+
+	hub := marvintest.StartHub(t, fmt.Sprintf(`
+		[bus.test]
+		type = "marvintest"
+
+		[reactor.scripts]
+		type = "script"
+		dir = %q
+		max_steps = %d
+		timeout = "500ms"
+	`, dir, uint64(1<<62)), registry.Known())
+
+	bus := hub.Bus("test")
+
+	// The script outlasts the watchdog, but it's already replied.
+	bus.Send("hello")
+	bus.ExpectReply("let me think about that")
+}
+
+func TestScriptManyReplies(t *testing.T) {
+	dir := t.TempDir()
+	writeScript(t, dir, "chatty.star", `
+def react(event):
+    for i in range(3):
+        reply("%s %d" % (event.text, i))
+`, time.Now())
+
+	hub := marvintest.StartHub(t, fmt.Sprintf(`
+		[bus.test]
+		type = "marvintest"
+
+		[reactor.scripts]
+		type = "script"
+		dir = %q
+	`, dir), registry.Known())
+
+	bus := hub.Bus("test")
+
+	for i := 0; i < 20; i++ {
+		bus.Send(fmt.Sprint(i))
+	}
+
+	for i := 0; i < 20; i++ {
+		for j := 0; j < 3; j++ {
+			bus.ExpectReply(fmt.Sprintf("%d %d", i, j))
+		}
+	}
+}
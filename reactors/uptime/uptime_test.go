@@ -0,0 +1,24 @@
+package uptime_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mmcclimon/marvin/marvintest"
+	"github.com/mmcclimon/marvin/reactors/uptime"
+)
+
+func TestUptime(t *testing.T) {
+	reactor, err := uptime.Assemble("uptime", nil)
+	if err != nil {
+		t.Fatalf("could not assemble: %s", err)
+	}
+
+	r := marvintest.RunReactor(t, reactor)
+
+	r.Send("what's your uptime?")
+	r.ExpectNoReply(50 * time.Millisecond)
+
+	r.Send("UPTIME")
+	r.ExpectReply("Online for 0s")
+}
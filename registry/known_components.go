@@ -2,20 +2,47 @@ package registry
 
 import (
 	"github.com/mmcclimon/marvin/buses/discord"
+	"github.com/mmcclimon/marvin/buses/replay"
 	"github.com/mmcclimon/marvin/buses/term"
+	"github.com/mmcclimon/marvin/middlewares/ignore"
+	"github.com/mmcclimon/marvin/middlewares/logging"
+	"github.com/mmcclimon/marvin/middlewares/smartquotes"
+	"github.com/mmcclimon/marvin/middlewares/wordfilter"
 	"github.com/mmcclimon/marvin/reactors/echo"
 	"github.com/mmcclimon/marvin/reactors/eject"
+	"github.com/mmcclimon/marvin/reactors/external"
+	"github.com/mmcclimon/marvin/reactors/script"
 	"github.com/mmcclimon/marvin/reactors/uptime"
 )
 
-// RegisterAllKnownComponents adds all the default buses and reactors with
-// their well-known names (i.e., buses/term gets registered as "term",
-// reactors/echo as "echo", and so on).
+// RegisterAllKnownComponents adds all the default buses, reactors, and
+// middleware with their well-known names (i.e., buses/term gets registered
+// as "term", reactors/echo as "echo", and so on) to the default registry.
 func RegisterAllKnownComponents() {
-	RegisterBus("term", term.Assemble)
-	RegisterBus("discord", discord.Assemble)
+	registerKnownComponents(defaultRegistry)
+}
+
+// Known returns a new registry containing all the well-known components. It
+// does not touch the default registry, and can be called any number of times.
+func Known() *Registry {
+	r := New()
+	registerKnownComponents(r)
+	return r
+}
+
+func registerKnownComponents(r *Registry) {
+	r.RegisterBus("term", term.Assemble)
+	r.RegisterBus("discord", discord.Assemble)
+	r.RegisterBus("replay", replay.Assemble)
+
+	r.RegisterReactor("echo", echo.Assemble)
+	r.RegisterReactor("eject", eject.Assemble)
+	r.RegisterReactor("external", external.Assemble)
+	r.RegisterReactor("script", script.Assemble)
+	r.RegisterReactor("uptime", uptime.Assemble)
 
-	RegisterReactor("echo", echo.Assemble)
-	RegisterReactor("eject", eject.Assemble)
-	RegisterReactor("uptime", uptime.Assemble)
+	r.RegisterMiddleware("ignore", ignore.Assemble)
+	r.RegisterMiddleware("log", logging.Assemble)
+	r.RegisterMiddleware("smartquotes", smartquotes.Assemble)
+	r.RegisterMiddleware("wordfilter", wordfilter.Assemble)
 }
@@ -6,48 +6,156 @@ import (
 	"github.com/mmcclimon/marvin"
 )
 
+// A Registry maps the type names used in config files to the assemblers
+// that build them. Registries are independent of one another, so two hubs in
+// the same process can be assembled from different sets of components. The
+// zero value is an empty registry, ready to use, as is the one New returns.
 type Registry struct {
-	buses    map[string]marvin.BusAssembler
-	reactors map[string]marvin.ReactorAssembler
+	buses      map[string]marvin.BusAssembler
+	reactors   map[string]marvin.ReactorAssembler
+	middleware map[string]marvin.MiddlewareAssembler
 }
 
-var singleton = Registry{
-	buses:    make(map[string]marvin.BusAssembler),
-	reactors: make(map[string]marvin.ReactorAssembler),
+var defaultRegistry = New()
+
+func New() *Registry {
+	return &Registry{
+		buses:      make(map[string]marvin.BusAssembler),
+		reactors:   make(map[string]marvin.ReactorAssembler),
+		middleware: make(map[string]marvin.MiddlewareAssembler),
+	}
+}
+
+// Default returns the process-wide registry, which is what the package-level
+// RegisterBus, RegisterReactor, and RegisterMiddleware functions add to.
+//
+// Before there was New, Default returned a Registry rather than a *Registry.
+// Either way it's the default registry itself, not a copy: anything
+// registered on it is registered for everyone. Use Clone for a private copy.
+func Default() *Registry { return defaultRegistry }
+
+// Compose returns a new registry containing everything in base, with the
+// contents of each of the overrides layered on top in order (so that later
+// registries win). None of the arguments are modified. Any of them may be
+// nil, which counts as an empty registry.
+func Compose(base *Registry, overrides ...*Registry) *Registry {
+	composed := New()
+	if base != nil {
+		composed = base.Clone()
+	}
+
+	for _, o := range overrides {
+		if o == nil {
+			continue
+		}
+
+		for name, assembler := range o.buses {
+			composed.buses[name] = assembler
+		}
+
+		for name, assembler := range o.reactors {
+			composed.reactors[name] = assembler
+		}
+
+		for name, assembler := range o.middleware {
+			composed.middleware[name] = assembler
+		}
+	}
+
+	return composed
 }
 
-func Default() Registry { return singleton }
+// Clone returns a copy of the registry; registering things on the copy does
+// not affect the original, and vice versa.
+func (r *Registry) Clone() *Registry {
+	clone := New()
 
-func (r Registry) hasBus(name string) bool {
+	for name, assembler := range r.buses {
+		clone.buses[name] = assembler
+	}
+
+	for name, assembler := range r.reactors {
+		clone.reactors[name] = assembler
+	}
+
+	for name, assembler := range r.middleware {
+		clone.middleware[name] = assembler
+	}
+
+	return clone
+}
+
+func (r *Registry) hasBus(name string) bool {
 	_, ok := r.buses[name]
 	return ok
 }
 
-func (r Registry) hasReactor(name string) bool {
+func (r *Registry) hasReactor(name string) bool {
 	_, ok := r.reactors[name]
 	return ok
 }
 
-func (r Registry) ReactorFor(name string) marvin.ReactorAssembler {
-	return singleton.reactors[name]
+func (r *Registry) hasMiddleware(name string) bool {
+	_, ok := r.middleware[name]
+	return ok
 }
 
-func (r Registry) BusFor(name string) marvin.BusAssembler {
-	return singleton.buses[name]
+func (r *Registry) ReactorFor(name string) marvin.ReactorAssembler {
+	return r.reactors[name]
 }
 
-func RegisterReactor(name string, assembler marvin.ReactorAssembler) {
-	if singleton.hasReactor(name) {
+func (r *Registry) BusFor(name string) marvin.BusAssembler {
+	return r.buses[name]
+}
+
+func (r *Registry) MiddlewareFor(name string) marvin.MiddlewareAssembler {
+	return r.middleware[name]
+}
+
+func (r *Registry) RegisterReactor(name string, assembler marvin.ReactorAssembler) {
+	if r.hasReactor(name) {
 		panic(fmt.Sprintf("cannot register duplicate reactor '%s'", name))
 	}
 
-	singleton.reactors[name] = assembler
+	if r.reactors == nil {
+		r.reactors = make(map[string]marvin.ReactorAssembler)
+	}
+
+	r.reactors[name] = assembler
 }
 
-func RegisterBus(name string, assembler marvin.BusAssembler) {
-	if singleton.hasBus(name) {
+func (r *Registry) RegisterBus(name string, assembler marvin.BusAssembler) {
+	if r.hasBus(name) {
 		panic(fmt.Sprintf("cannot register duplicate bus '%s'", name))
 	}
 
-	singleton.buses[name] = assembler
+	if r.buses == nil {
+		r.buses = make(map[string]marvin.BusAssembler)
+	}
+
+	r.buses[name] = assembler
+}
+
+func (r *Registry) RegisterMiddleware(name string, assembler marvin.MiddlewareAssembler) {
+	if r.hasMiddleware(name) {
+		panic(fmt.Sprintf("cannot register duplicate middleware '%s'", name))
+	}
+
+	if r.middleware == nil {
+		r.middleware = make(map[string]marvin.MiddlewareAssembler)
+	}
+
+	r.middleware[name] = assembler
+}
+
+func RegisterReactor(name string, assembler marvin.ReactorAssembler) {
+	defaultRegistry.RegisterReactor(name, assembler)
+}
+
+func RegisterBus(name string, assembler marvin.BusAssembler) {
+	defaultRegistry.RegisterBus(name, assembler)
+}
+
+func RegisterMiddleware(name string, assembler marvin.MiddlewareAssembler) {
+	defaultRegistry.RegisterMiddleware(name, assembler)
 }
@@ -0,0 +1,194 @@
+package registry_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mmcclimon/marvin"
+	"github.com/mmcclimon/marvin/registry"
+)
+
+// Assemblers can't be compared, so these fail with their tag to say which
+// one they are.
+func busAssembler(tag string) marvin.BusAssembler {
+	return func(marvin.BusName, map[string]any) (marvin.Bus, error) {
+		return nil, errors.New(tag)
+	}
+}
+
+func reactorAssembler(tag string) marvin.ReactorAssembler {
+	return func(marvin.ReactorName, map[string]any) (marvin.Reactor, error) {
+		return nil, errors.New(tag)
+	}
+}
+
+func middlewareAssembler(tag string) marvin.MiddlewareAssembler {
+	return func(marvin.MiddlewareName, map[string]any) (marvin.Middleware, error) {
+		return nil, errors.New(tag)
+	}
+}
+
+// tags returns the tags of the bus, reactor, and middleware registered as
+// name, or "" for any that aren't.
+func tags(r *registry.Registry, name string) (bus, reactor, middleware string) {
+	if a := r.BusFor(name); a != nil {
+		_, err := a("", nil)
+		bus = err.Error()
+	}
+
+	if a := r.ReactorFor(name); a != nil {
+		_, err := a("", nil)
+		reactor = err.Error()
+	}
+
+	if a := r.MiddlewareFor(name); a != nil {
+		_, err := a("", nil)
+		middleware = err.Error()
+	}
+
+	return bus, reactor, middleware
+}
+
+func expectTags(t *testing.T, r *registry.Registry, name, bus, reactor, middleware string) {
+	t.Helper()
+
+	gotBus, gotReactor, gotMiddleware := tags(r, name)
+	if gotBus != bus || gotReactor != reactor || gotMiddleware != middleware {
+		t.Errorf("%s is registered as (%q, %q, %q), wanted (%q, %q, %q)",
+			name, gotBus, gotReactor, gotMiddleware, bus, reactor, middleware)
+	}
+}
+
+func register(r *registry.Registry, name, tag string) {
+	r.RegisterBus(name, busAssembler(tag))
+	r.RegisterReactor(name, reactorAssembler(tag))
+	r.RegisterMiddleware(name, middlewareAssembler(tag))
+}
+
+func TestRegister(t *testing.T) {
+	for desc, r := range map[string]*registry.Registry{
+		"New":        registry.New(),
+		"zero value": {},
+	} {
+		t.Run(desc, func(t *testing.T) {
+			expectTags(t, r, "thing", "", "", "")
+
+			register(r, "thing", "a")
+			expectTags(t, r, "thing", "a", "a", "a")
+		})
+	}
+}
+
+func TestRegisterDuplicate(t *testing.T) {
+	r := registry.New()
+	register(r, "thing", "a")
+
+	for kind, again := range map[string]func(){
+		"bus":        func() { r.RegisterBus("thing", busAssembler("b")) },
+		"reactor":    func() { r.RegisterReactor("thing", reactorAssembler("b")) },
+		"middleware": func() { r.RegisterMiddleware("thing", middlewareAssembler("b")) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("registering a duplicate %s didn't panic", kind)
+				}
+			}()
+
+			again()
+		}()
+	}
+
+	expectTags(t, r, "thing", "a", "a", "a")
+}
+
+func TestClone(t *testing.T) {
+	original := registry.New()
+	register(original, "shared", "original")
+
+	clone := original.Clone()
+	expectTags(t, clone, "shared", "original", "original", "original")
+
+	register(clone, "cloned", "clone")
+	register(original, "late", "original")
+
+	expectTags(t, original, "cloned", "", "", "")
+	expectTags(t, clone, "late", "", "", "")
+
+	// Cloning the zero value works, too.
+	var zero registry.Registry
+	register(zero.Clone(), "thing", "a")
+	expectTags(t, &zero, "thing", "", "", "")
+}
+
+func TestCompose(t *testing.T) {
+	base := registry.New()
+	register(base, "shared", "base")
+	register(base, "base-only", "base")
+
+	first := registry.New()
+	register(first, "shared", "first")
+	first.RegisterBus("first-only", busAssembler("first"))
+
+	second := &registry.Registry{}
+	second.RegisterBus("shared", busAssembler("second"))
+
+	composed := registry.Compose(base, first, second)
+
+	// Later registries win, one kind of component at a time.
+	expectTags(t, composed, "shared", "second", "first", "first")
+	expectTags(t, composed, "base-only", "base", "base", "base")
+	expectTags(t, composed, "first-only", "first", "", "")
+
+	// None of the inputs changed, and the result is a new registry.
+	expectTags(t, base, "shared", "base", "base", "base")
+	expectTags(t, base, "first-only", "", "", "")
+	expectTags(t, first, "base-only", "", "", "")
+
+	register(composed, "new", "composed")
+	expectTags(t, base, "new", "", "", "")
+}
+
+func TestComposeNil(t *testing.T) {
+	override := registry.New()
+	register(override, "override", "override")
+
+	composed := registry.Compose(nil, nil, override)
+	expectTags(t, composed, "override", "override", "override", "override")
+
+	register(composed, "new", "composed")
+	expectTags(t, override, "new", "", "", "")
+}
+
+func TestKnown(t *testing.T) {
+	known := registry.Known()
+
+	if known.BusFor("term") == nil || known.ReactorFor("echo") == nil || known.MiddlewareFor("wordfilter") == nil {
+		t.Error("Known is missing well-known components")
+	}
+
+	// Each call makes a new registry, and none of them are the default.
+	register(known, "extra", "known")
+	expectTags(t, registry.Known(), "extra", "", "", "")
+	expectTags(t, registry.Default(), "extra", "", "", "")
+}
+
+func TestDefault(t *testing.T) {
+	if registry.Default() != registry.Default() {
+		t.Fatal("Default returned different registries")
+	}
+
+	// The package-level functions register on the default registry, which
+	// is shared rather than copied.
+	// That also means it outlives the test, so use a name that an earlier
+	// run (with -count, say) can't have registered.
+	name := fmt.Sprintf("registry-test-%d", time.Now().UnixNano())
+
+	registry.RegisterBus(name, busAssembler("default"))
+	expectTags(t, registry.Default(), name, "default", "", "")
+
+	registry.Default().RegisterReactor(name, reactorAssembler("default"))
+	expectTags(t, registry.Default(), name, "default", "default", "")
+}
@@ -0,0 +1,114 @@
+package marvin
+
+import (
+	"fmt"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// reactorScope limits which events a reactor sees. These settings live in
+// the reactor's own config table, but they're the hub's business, so they're
+// taken out before the rest is passed to the reactor's assembler:
+//
+//	[reactor.eject]
+//	type = "eject"
+//	buses = ["term"]
+//
+//	[reactor.echo]
+//	type = "echo"
+//	channels = ["1234567890"]
+//
+//	[reactor.poll]
+//	type = "poll"
+//	events = ["message", "reaction", "edit", "delete"]
+//
+// Channels are matched against event addresses; on Discord, that's the
+// channel id. An empty scope lets every message through; other kinds of
+// event have to be asked for.
+type reactorScope struct {
+	Buses           []BusName `mapstructure:"buses"`
+	Channels        []string  `mapstructure:"channels"`
+	ExcludeChannels []string  `mapstructure:"exclude_channels"`
+	DMOnly          bool      `mapstructure:"dm_only"`
+	Events          []string  `mapstructure:"events"`
+}
+
+var scopeKeys = []string{"buses", "channels", "exclude_channels", "dm_only", "events"}
+
+func extractScope(rawConf arbitraryConfig) (reactorScope, error) {
+	var scope reactorScope
+
+	if err := mapstructure.Decode(rawConf, &scope); err != nil {
+		return scope, err
+	}
+
+	for _, key := range scopeKeys {
+		delete(rawConf, key)
+	}
+
+	return scope, nil
+}
+
+func (s reactorScope) validate(hub *Hub) error {
+	for _, bus := range s.Buses {
+		if _, ok := hub.buses[bus]; !ok {
+			return fmt.Errorf("no bus named '%s'", bus)
+		}
+	}
+
+	for _, name := range s.Events {
+		known := false
+		for _, kind := range eventKinds {
+			known = known || kind.String() == name
+		}
+
+		if !known {
+			return fmt.Errorf("unknown event kind '%s'", name)
+		}
+	}
+
+	return nil
+}
+
+func (s reactorScope) allows(event Event) bool {
+	if len(s.Events) == 0 && event.Kind != KindMessage {
+		return false
+	}
+
+	if len(s.Events) > 0 && !contains(s.Events, event.Kind.String()) {
+		return false
+	}
+
+	if s.DMOnly && !event.Direct {
+		return false
+	}
+
+	if len(s.Buses) > 0 && !contains(s.Buses, event.SourceBus) {
+		return false
+	}
+
+	if len(s.Channels) == 0 && len(s.ExcludeChannels) == 0 {
+		return true
+	}
+
+	channel := fmt.Sprint(event.Address)
+	if event.Address == nil {
+		channel = ""
+	}
+
+	if len(s.Channels) > 0 && !contains(s.Channels, channel) {
+		return false
+	}
+
+	return !contains(s.ExcludeChannels, channel)
+}
+
+func contains[T comparable](haystack []T, needle T) bool {
+	for _, x := range haystack {
+		if x == needle {
+			return true
+		}
+	}
+
+	return false
+}
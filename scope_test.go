@@ -0,0 +1,156 @@
+package marvin_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mmcclimon/marvin"
+	"github.com/mmcclimon/marvin/marvintest"
+	"github.com/mmcclimon/marvin/registry"
+)
+
+// witness is a reactor that says what kind of event it saw, and nothing else.
+type witness struct{}
+
+func (witness) Run(ctx context.Context, comm marvin.ReactorBundle) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-comm.Events:
+			event.MarkHandled()
+
+			select {
+			case comm.Replies <- event.Reply("saw %s", event.Kind):
+			case <-ctx.Done():
+			}
+		}
+	}
+}
+
+func startScopedHub(t *testing.T, scope string) *marvintest.Hub {
+	t.Helper()
+
+	reg := registry.Known()
+	reg.RegisterReactor("witness", func(marvin.ReactorName, map[string]any) (marvin.Reactor, error) {
+		return witness{}, nil
+	})
+
+	return marvintest.StartHub(t, fmt.Sprintf(`
+		[bus.one]
+		type = "marvintest"
+
+		[bus.two]
+		type = "marvintest"
+
+		[reactor.witness]
+		type = "witness"
+		%s
+	`, scope), reg)
+}
+
+func TestScope(t *testing.T) {
+	general := marvintest.WithAddress("general")
+	random := marvintest.WithAddress("random")
+
+	t.Run("buses", func(t *testing.T) {
+		hub := startScopedHub(t, `buses = ["one"]`)
+
+		hub.Bus("one").Send("hello")
+		hub.Bus("one").ExpectReply("saw message")
+
+		hub.Bus("two").Send("hello")
+		hub.Bus("two").ExpectReply("does not compute")
+	})
+
+	t.Run("channels", func(t *testing.T) {
+		hub := startScopedHub(t, `channels = ["general"]`)
+		bus := hub.Bus("one")
+
+		bus.Send("hello", general)
+		bus.ExpectReply("saw message")
+
+		bus.Send("hello", random)
+		bus.ExpectReply("does not compute")
+
+		bus.Send("hello")
+		bus.ExpectReply("does not compute")
+	})
+
+	t.Run("exclude_channels", func(t *testing.T) {
+		hub := startScopedHub(t, `exclude_channels = ["random"]`)
+		bus := hub.Bus("one")
+
+		bus.Send("hello", general)
+		bus.ExpectReply("saw message")
+
+		bus.Send("hello", random)
+		bus.ExpectReply("does not compute")
+
+		bus.Send("hello")
+		bus.ExpectReply("saw message")
+	})
+
+	t.Run("dm_only", func(t *testing.T) {
+		hub := startScopedHub(t, `dm_only = true`)
+		bus := hub.Bus("one")
+
+		bus.Send("hello", marvintest.WithDirect())
+		bus.ExpectReply("saw message")
+
+		bus.Send("hello")
+		bus.ExpectReply("does not compute")
+	})
+
+	t.Run("events", func(t *testing.T) {
+		hub := startScopedHub(t, `events = ["reaction"]`)
+		bus := hub.Bus("one")
+
+		bus.Send("", marvintest.WithReaction("42", "👍"))
+		bus.ExpectReply("saw reaction")
+
+		bus.Send("hello")
+		bus.ExpectReply("does not compute")
+	})
+
+	t.Run("messages by default", func(t *testing.T) {
+		hub := startScopedHub(t, ``)
+		bus := hub.Bus("one")
+
+		bus.Send("", marvintest.WithReaction("42", "👍"))
+		bus.ExpectNoReply(50 * time.Millisecond)
+
+		bus.Send("hello")
+		bus.ExpectReply("saw message")
+	})
+}
+
+func TestBadScope(t *testing.T) {
+	assemble := func(scope string) error {
+		_, err := marvin.FromString(fmt.Sprintf(`
+			[bus.one]
+			type = "term"
+
+			[reactor.echo]
+			type = "echo"
+			%s
+		`, scope), registry.Known())
+
+		return err
+	}
+
+	if err := assemble(`buses = ["one"]`); err != nil {
+		t.Fatalf("could not assemble hub with good scope: %s", err)
+	}
+
+	for _, scope := range []string{
+		`buses = ["nowhere"]`,
+		`events = ["sneeze"]`,
+	} {
+		if assemble(scope) == nil {
+			t.Errorf("assembled a hub with bad scope: %s", scope)
+		}
+	}
+}
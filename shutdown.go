@@ -0,0 +1,91 @@
+package marvin
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// A ShutdownHook is a bus or reactor that wants to do something before the
+// hub shuts down: persist some state, say, or post a goodbye message.
+//
+// OnShutdown is called after the hub has stopped taking new events and
+// drained the ones in flight, but before any component's context is
+// cancelled, so buses are still running and reactors may still send
+// replies. Reactors' hooks run before buses', so that buses see any last
+// replies before their own hooks run. ctx expires at the shutdown deadline.
+type ShutdownHook interface {
+	OnShutdown(ctx context.Context) error
+}
+
+const (
+	defaultShutdownTimeout = 5 * time.Second
+
+	// Once nothing is in flight, we wait this long without seeing a reply
+	// before deciding that reactors have nothing more to say.
+	drainQuiet = 100 * time.Millisecond
+	drainTick  = 10 * time.Millisecond
+)
+
+// shutdown runs the first phase of shutting down: stop accepting events,
+// wait for the ones in flight and their replies, and run the shutdown
+// hooks. When it returns, it's time to cancel the components.
+func (h *Hub) shutdown() {
+	slog.Info("shutting down hub", "timeout", h.shutdownGrace)
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.shutdownGrace)
+	defer cancel()
+
+	h.draining.Store(true)
+
+	h.drain(ctx)
+	h.runShutdownHooks(ctx, kindReactor)
+	h.drain(ctx)
+	h.runShutdownHooks(ctx, kindBus)
+}
+
+// drain waits until there are no events or replies in flight and no replies
+// have come through for a little while, or until ctx expires. A reply is in
+// flight from when it's made until the hub has handed it to its bus. The
+// quiet period counts from when we start, too, so that a reply a shutdown
+// hook has only just sent has time to get counted.
+func (h *Hub) drain(ctx context.Context) {
+	ticker := time.NewTicker(drainTick)
+	defer ticker.Stop()
+
+	start := time.Now()
+
+	for {
+		last := max(h.lastReply.Load(), start.UnixNano())
+		quietFor := time.Since(time.Unix(0, last))
+		if h.inFlight.Load() == 0 && quietFor >= drainQuiet {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			slog.Warn("gave up draining events", "in_flight", h.inFlight.Load())
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *Hub) runShutdownHooks(ctx context.Context, kind componentKind) {
+	for _, status := range h.statuses {
+		hook, ok := status.component.(ShutdownHook)
+		if status.kind != kind || !ok {
+			continue
+		}
+
+		if ctx.Err() != nil {
+			slog.Warn("no time left for shutdown hook", "kind", kind, "name", status.name)
+			continue
+		}
+
+		if err := hook.OnShutdown(ctx); err != nil {
+			slog.Warn("error in shutdown hook", "kind", kind, "name", status.name, "err", err)
+			status.recordError(err)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package marvin_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/mmcclimon/marvin"
+	"github.com/mmcclimon/marvin/marvintest"
+	"github.com/mmcclimon/marvin/registry"
+)
+
+func TestShutdownDeliversLastReply(t *testing.T) {
+	hub := marvintest.StartHub(t, `
+		[bus.test]
+		type = "marvintest"
+
+		[reactor.eject]
+		type = "eject"
+	`, registry.Known())
+
+	bus := hub.Bus("test")
+	bus.Send("eject warp core")
+
+	if err := hub.Wait(); !errors.Is(err, marvin.ErrShuttingDown) {
+		t.Errorf("hub exited with %v, wanted ErrShuttingDown", err)
+	}
+
+	bus.ExpectReply("so long!")
+}
+
+// farewell is a reactor that says goodbye when the hub shuts down, and
+// notes when that happened.
+type farewell struct {
+	replies chan<- marvin.Reply
+	order   *[]string
+	mu      *sync.Mutex
+}
+
+func (f *farewell) Run(ctx context.Context, comm marvin.ReactorBundle) error {
+	f.replies = comm.Replies
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-comm.Events:
+			event.MarkHandled()
+			comm.Replies <- event.Reply("hello yourself")
+		}
+	}
+}
+
+func (f *farewell) OnShutdown(ctx context.Context) error {
+	f.mu.Lock()
+	*f.order = append(*f.order, "reactor")
+	f.mu.Unlock()
+
+	f.replies <- marvin.Reply{Bus: "test", Address: "general", Text: "so long, and thanks for all the fish"}
+	return nil
+}
+
+// hookedBus is a fake bus that notes when its shutdown hook runs.
+type hookedBus struct {
+	*marvintest.Bus
+	order *[]string
+	mu    *sync.Mutex
+}
+
+func (b *hookedBus) OnShutdown(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	*b.order = append(*b.order, "bus")
+	return nil
+}
+
+func TestShutdownHooks(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	var bus *hookedBus
+
+	reg := registry.New()
+	reg.RegisterReactor("farewell", func(marvin.ReactorName, map[string]any) (marvin.Reactor, error) {
+		return &farewell{order: &order, mu: &mu}, nil
+	})
+	reg.RegisterBus("hooked", func(name marvin.BusName, _ map[string]any) (marvin.Bus, error) {
+		bus = &hookedBus{Bus: marvintest.NewBus(t, name), order: &order, mu: &mu}
+		return bus, nil
+	})
+
+	hub := marvintest.StartHub(t, `
+		[bus.test]
+		type = "hooked"
+
+		[reactor.farewell]
+		type = "farewell"
+	`, reg)
+
+	bus.Send("hello")
+	bus.ExpectReply("hello yourself")
+
+	if err := hub.Stop(); err != nil {
+		t.Fatalf("hub stopped with error: %s", err)
+	}
+
+	bus.ExpectReply("so long, and thanks for all the fish")
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(order) != 2 || order[0] != "reactor" || order[1] != "bus" {
+		t.Errorf("shutdown hooks ran in order %v, wanted reactor then bus", order)
+	}
+}
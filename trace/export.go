@@ -0,0 +1,239 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An Exporter sends finished spans somewhere.
+type Exporter interface {
+	Export(context.Context, []SpanData) error
+	Close() error
+}
+
+// FileExporter writes spans to a file as JSON, one per line, for offline
+// analysis.
+type FileExporter struct {
+	file *os.File
+	enc  *json.Encoder
+}
+
+type fileSpan struct {
+	TraceID    string         `json:"trace_id"`
+	SpanID     string         `json:"span_id"`
+	ParentID   string         `json:"parent_id,omitempty"`
+	Name       string         `json:"name"`
+	Start      time.Time      `json:"start"`
+	End        time.Time      `json:"end"`
+	DurationMS float64        `json:"duration_ms"`
+	Attrs      map[string]any `json:"attrs,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+func NewFileExporter(path string) (*FileExporter, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open trace file: %w", err)
+	}
+
+	return &FileExporter{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+func (e *FileExporter) Export(_ context.Context, spans []SpanData) error {
+	for _, span := range spans {
+		fs := fileSpan{
+			TraceID:    span.TraceID.String(),
+			SpanID:     span.SpanID.String(),
+			Name:       span.Name,
+			Start:      span.Start,
+			End:        span.End,
+			DurationMS: float64(span.End.Sub(span.Start)) / float64(time.Millisecond),
+		}
+
+		if !span.ParentID.IsZero() {
+			fs.ParentID = span.ParentID.String()
+		}
+
+		if len(span.Attrs) > 0 {
+			fs.Attrs = make(map[string]any, len(span.Attrs))
+			for _, attr := range span.Attrs {
+				fs.Attrs[attr.Key] = attr.Value
+			}
+		}
+
+		if span.Err != nil {
+			fs.Error = span.Err.Error()
+		}
+
+		if err := e.enc.Encode(fs); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *FileExporter) Close() error {
+	return e.file.Close()
+}
+
+// OTLPExporter sends spans to an OpenTelemetry collector using OTLP over
+// HTTP, with JSON encoding.
+type OTLPExporter struct {
+	url     string
+	service string
+	client  *http.Client
+}
+
+// NewOTLPExporter returns an exporter for the collector at endpoint (like
+// "http://localhost:4318"); spans are reported as coming from the named
+// service.
+func NewOTLPExporter(endpoint, service string) *OTLPExporter {
+	return &OTLPExporter{
+		url:     strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		service: service,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// These follow the OTLP JSON encoding, which is the protobuf JSON mapping
+// except that IDs are hex strings.
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttr `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string      `json:"traceId"`
+	SpanID            string      `json:"spanId"`
+	ParentSpanID      string      `json:"parentSpanId,omitempty"`
+	Name              string      `json:"name"`
+	Kind              int         `json:"kind"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string      `json:"endTimeUnixNano"`
+	Attributes        []otlpAttr  `json:"attributes,omitempty"`
+	Status            *otlpStatus `json:"status,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+const (
+	otlpKindInternal = 1
+	otlpStatusError  = 2
+)
+
+func (e *OTLPExporter) Export(ctx context.Context, spans []SpanData) error {
+	scope := otlpScopeSpans{Scope: otlpScope{Name: "marvin"}}
+
+	for _, span := range spans {
+		out := otlpSpan{
+			TraceID:           span.TraceID.String(),
+			SpanID:            span.SpanID.String(),
+			Name:              span.Name,
+			Kind:              otlpKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+		}
+
+		if !span.ParentID.IsZero() {
+			out.ParentSpanID = span.ParentID.String()
+		}
+
+		for _, attr := range span.Attrs {
+			out.Attributes = append(out.Attributes, otlpAttribute(attr))
+		}
+
+		if span.Err != nil {
+			out.Status = &otlpStatus{Code: otlpStatusError, Message: span.Err.Error()}
+		}
+
+		scope.Spans = append(scope.Spans, out)
+	}
+
+	body, err := json.Marshal(otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []otlpAttr{otlpAttribute(String("service.name", e.service))},
+			},
+			ScopeSpans: []otlpScopeSpans{scope},
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("bad json encode: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("bad request creation: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not send spans: %w", err)
+	}
+
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("collector returned %s", res.Status)
+	}
+
+	return nil
+}
+
+func (e *OTLPExporter) Close() error { return nil }
+
+func otlpAttribute(attr Attr) otlpAttr {
+	var value map[string]any
+
+	switch v := attr.Value.(type) {
+	case string:
+		value = map[string]any{"stringValue": v}
+	case bool:
+		value = map[string]any{"boolValue": v}
+	case int64:
+		value = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		value = map[string]any{"doubleValue": v}
+	default:
+		value = map[string]any{"stringValue": fmt.Sprint(v)}
+	}
+
+	return otlpAttr{Key: attr.Key, Value: value}
+}
@@ -0,0 +1,248 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSpans returns a finished root span and a failed child of it.
+func testSpans() (SpanData, SpanData) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	root := SpanData{
+		TraceID: TraceID{1, 2, 3},
+		SpanID:  SpanID{4, 5, 6},
+		Name:    "event",
+		Start:   start,
+		End:     start.Add(1500 * time.Microsecond),
+		Attrs:   []Attr{Int("event.id", 42), String("event.bus", "test")},
+	}
+
+	child := SpanData{
+		TraceID:  root.TraceID,
+		SpanID:   SpanID{7, 8, 9},
+		ParentID: root.SpanID,
+		Name:     "reactor",
+		Start:    start,
+		End:      start.Add(time.Millisecond),
+		Attrs:    []Attr{Bool("replied", false)},
+		Err:      errors.New("no dice"),
+	}
+
+	return root, child
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+
+	exporter, err := NewFileExporter(path)
+	if err != nil {
+		t.Fatalf("could not make exporter: %s", err)
+	}
+
+	root, child := testSpans()
+	if err := exporter.Export(context.Background(), []SpanData{root, child}); err != nil {
+		t.Fatalf("could not export: %s", err)
+	}
+
+	exporter.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, wanted 2:\n%s", len(lines), data)
+	}
+
+	var got []fileSpan
+	for _, line := range lines {
+		var fs fileSpan
+		if err := json.Unmarshal([]byte(line), &fs); err != nil {
+			t.Fatalf("bad line %q: %s", line, err)
+		}
+
+		got = append(got, fs)
+	}
+
+	if got[0].TraceID != root.TraceID.String() || got[0].SpanID != root.SpanID.String() || got[0].ParentID != "" {
+		t.Errorf("root span has the wrong ids: %+v", got[0])
+	}
+
+	if got[0].DurationMS != 1.5 {
+		t.Errorf("root span took %vms, wanted 1.5", got[0].DurationMS)
+	}
+
+	// Numbers come back from JSON as floats.
+	if got[0].Attrs["event.id"] != float64(42) || got[0].Attrs["event.bus"] != "test" {
+		t.Errorf("root span has the wrong attributes: %v", got[0].Attrs)
+	}
+
+	if got[1].ParentID != root.SpanID.String() || got[1].Error != "no dice" || got[1].Attrs["replied"] != false {
+		t.Errorf("child span is wrong: %+v", got[1])
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	requests := make(chan otlpRequest, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		requests <- req
+	}))
+	defer srv.Close()
+
+	root, child := testSpans()
+	exporter := NewOTLPExporter(srv.URL+"/", "marvin-test")
+
+	if err := exporter.Export(context.Background(), []SpanData{root, child}); err != nil {
+		t.Fatalf("could not export: %s", err)
+	}
+
+	req := <-requests
+	if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("got unexpected request shape: %+v", req)
+	}
+
+	rs := req.ResourceSpans[0]
+	service := rs.Resource.Attributes
+	if len(service) != 1 || service[0].Key != "service.name" || service[0].Value["stringValue"] != "marvin-test" {
+		t.Errorf("got resource attributes %+v", service)
+	}
+
+	spans := rs.ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, wanted 2", len(spans))
+	}
+
+	got := spans[0]
+	if got.TraceID != root.TraceID.String() || got.Name != "event" || got.Kind != otlpKindInternal {
+		t.Errorf("root span is wrong: %+v", got)
+	}
+
+	if got.StartTimeUnixNano != "1704164645000000000" || got.EndTimeUnixNano != "1704164645001500000" {
+		t.Errorf("root span has times %s to %s", got.StartTimeUnixNano, got.EndTimeUnixNano)
+	}
+
+	// OTLP JSON wants 64-bit ints as strings.
+	if attr := got.Attributes[0]; attr.Key != "event.id" || attr.Value["intValue"] != "42" {
+		t.Errorf("root span has attribute %+v", attr)
+	}
+
+	got = spans[1]
+	if got.ParentSpanID != root.SpanID.String() || got.Status == nil || got.Status.Code != otlpStatusError || got.Status.Message != "no dice" {
+		t.Errorf("child span is wrong: %+v", got)
+	}
+
+	if attr := got.Attributes[0]; attr.Key != "replied" || attr.Value["boolValue"] != false {
+		t.Errorf("child span has attribute %+v", attr)
+	}
+}
+
+func TestOTLPExporterError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	root, _ := testSpans()
+	err := NewOTLPExporter(srv.URL, "marvin").Export(context.Background(), []SpanData{root})
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("got error %v, wanted one about the 503", err)
+	}
+}
+
+// memoryExporter remembers what it's given.
+type memoryExporter struct {
+	spans  chan SpanData
+	closed chan struct{}
+}
+
+func (e *memoryExporter) Export(_ context.Context, spans []SpanData) error {
+	for _, span := range spans {
+		e.spans <- span
+	}
+
+	return nil
+}
+
+func (e *memoryExporter) Close() error {
+	close(e.closed)
+	return nil
+}
+
+func TestTracerFlushesOnShutdown(t *testing.T) {
+	exporter := &memoryExporter{spans: make(chan SpanData, 16), closed: make(chan struct{})}
+	tracer := NewTracer(exporter)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		tracer.Run(ctx)
+	}()
+
+	root := tracer.StartRoot("event", time.Now())
+	ctx2, child := Start(ContextWithSpan(context.Background(), root), "child")
+	child.End()
+	root.End()
+	root.End() // again, which does nothing
+
+	if SpanFromContext(ctx2) != child {
+		t.Error("Start didn't put the new span in its context")
+	}
+
+	cancel()
+	<-done
+
+	select {
+	case <-exporter.closed:
+	default:
+		t.Error("tracer didn't close its exporter")
+	}
+
+	if n := len(exporter.spans); n != 2 {
+		t.Fatalf("exported %d spans, wanted 2", n)
+	}
+
+	if got := <-exporter.spans; got.Name != "child" || got.ParentID != root.data.SpanID {
+		t.Errorf("first span exported was %+v", got)
+	}
+}
+
+func TestNilTracing(t *testing.T) {
+	var tracer *Tracer
+
+	// None of this should panic.
+	span := tracer.StartRoot("event", time.Now())
+	child := span.StartChild("child")
+	child.SetAttributes(Bool("ok", true))
+	child.RecordError(errors.New("oops"))
+	child.End()
+
+	ctx, span := Start(context.Background(), "untraced")
+	if span != nil || SpanFromContext(ctx) != nil {
+		t.Error("started a span without a tracer")
+	}
+}
@@ -0,0 +1,253 @@
+// Package trace is a small, OpenTelemetry-flavored tracing library: spans
+// with trace and span IDs, parents, attributes, and errors, carried around in
+// contexts and exported in batches.
+//
+// Everything is safe to use with a nil *Tracer or *Span, in which case
+// nothing is recorded; code can be instrumented unconditionally, and only
+// pays for it when tracing is turned on.
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+func (id SpanID) String() string  { return hex.EncodeToString(id[:]) }
+func (id SpanID) IsZero() bool    { return id == SpanID{} }
+
+type Attr struct {
+	Key   string
+	Value any
+}
+
+func String(key, value string) Attr    { return Attr{key, value} }
+func Int(key string, value int64) Attr { return Attr{key, value} }
+func Bool(key string, value bool) Attr { return Attr{key, value} }
+
+// Span is a single timed operation. Spans are started with Tracer.StartRoot
+// or Start, and must be ended with End, after which they're exported.
+type Span struct {
+	tracer *Tracer
+
+	mu   sync.Mutex
+	data SpanData
+	done bool
+}
+
+// SpanData is the exported form of a finished span.
+type SpanData struct {
+	TraceID  TraceID
+	SpanID   SpanID
+	ParentID SpanID
+	Name     string
+	Start    time.Time
+	End      time.Time
+	Attrs    []Attr
+	Err      error
+}
+
+// Tracer collects finished spans and hands them off to an exporter in
+// batches. Use NewTracer to make one, and call Run to start exporting.
+type Tracer struct {
+	exporter Exporter
+	finished chan SpanData
+}
+
+const (
+	batchSize     = 128
+	batchInterval = 5 * time.Second
+)
+
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{
+		exporter: exporter,
+		finished: make(chan SpanData, 4*batchSize),
+	}
+}
+
+// Run exports spans until ctx is cancelled, then exports whatever's left and
+// shuts down the exporter.
+func (t *Tracer) Run(ctx context.Context) {
+	ticker := time.NewTicker(batchInterval)
+	defer ticker.Stop()
+
+	var batch []SpanData
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		// Use a fresh context here, so that we can still flush on shutdown.
+		exportCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := t.exporter.Export(exportCtx, batch); err != nil {
+			slog.Warn("could not export spans", "count", len(batch), "err", err)
+		}
+
+		batch = nil
+	}
+
+	for {
+		select {
+		case span := <-t.finished:
+			batch = append(batch, span)
+			if len(batch) >= batchSize {
+				flush()
+			}
+
+		case <-ticker.C:
+			flush()
+
+		case <-ctx.Done():
+			for drained := false; !drained; {
+				select {
+				case span := <-t.finished:
+					batch = append(batch, span)
+				default:
+					drained = true
+				}
+			}
+
+			flush()
+
+			if err := t.exporter.Close(); err != nil {
+				slog.Warn("could not shut down span exporter", "err", err)
+			}
+
+			return
+		}
+	}
+}
+
+// StartRoot starts a new trace, whose root span started at the given time
+// (which may be in the past, if the operation began before we knew it should
+// be traced).
+func (t *Tracer) StartRoot(name string, start time.Time, attrs ...Attr) *Span {
+	if t == nil {
+		return nil
+	}
+
+	return &Span{
+		tracer: t,
+		data: SpanData{
+			TraceID: newTraceID(),
+			SpanID:  newSpanID(),
+			Name:    name,
+			Start:   start,
+			Attrs:   attrs,
+		},
+	}
+}
+
+// StartChild starts a new span whose parent is s.
+func (s *Span) StartChild(name string, attrs ...Attr) *Span {
+	if s == nil {
+		return nil
+	}
+
+	return &Span{
+		tracer: s.tracer,
+		data: SpanData{
+			TraceID:  s.data.TraceID,
+			SpanID:   newSpanID(),
+			ParentID: s.data.SpanID,
+			Name:     name,
+			Start:    time.Now(),
+			Attrs:    attrs,
+		},
+	}
+}
+
+func (s *Span) SetAttributes(attrs ...Attr) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Attrs = append(s.data.Attrs, attrs...)
+}
+
+// RecordError marks the span as failed.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Err = err
+}
+
+// End finishes the span and queues it for export. Calling End more than once
+// does nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.done {
+		s.mu.Unlock()
+		return
+	}
+
+	s.done = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	select {
+	case s.tracer.finished <- data:
+	default:
+		slog.Warn("span exporter is backed up; dropping span", "name", data.Name)
+	}
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a context carrying span, so that spans started
+// from it with Start are its children.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Start starts a child of the span in ctx, and returns a context carrying
+// the new span. If there's no span in ctx, nothing is traced.
+func Start(ctx context.Context, name string, attrs ...Attr) (context.Context, *Span) {
+	span := SpanFromContext(ctx).StartChild(name, attrs...)
+	return ContextWithSpan(ctx, span), span
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	_, _ = rand.Read(id[:])
+	return id
+}
@@ -0,0 +1,160 @@
+package marvin
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mmcclimon/marvin/trace"
+)
+
+type TracingConfig struct {
+	// Exporter is "otlp" to send spans to an OpenTelemetry collector, or
+	// "file" to write them to a local file. If it's empty, there's no
+	// tracing.
+	Exporter    string
+	Endpoint    string // for otlp, like "http://localhost:4318"
+	File        string // for file
+	ServiceName string `toml:"service_name"`
+}
+
+func newTracer(cfg TracingConfig) (*trace.Tracer, error) {
+	service := cfg.ServiceName
+	if service == "" {
+		service = "marvin"
+	}
+
+	switch cfg.Exporter {
+	case "":
+		return nil, nil
+
+	case "otlp":
+		if cfg.Endpoint == "" {
+			return nil, fmt.Errorf("otlp tracing needs an endpoint")
+		}
+
+		return trace.NewTracer(trace.NewOTLPExporter(cfg.Endpoint, service)), nil
+
+	case "file":
+		exporter, err := trace.NewFileExporter(cfg.File)
+		if err != nil {
+			return nil, err
+		}
+
+		return trace.NewTracer(exporter), nil
+
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+}
+
+const reactorSpanGrace = 5 * time.Second
+
+// eventTrace holds the spans for a single event: a root span covering the
+// whole thing, from the moment the bus created the event until it's first
+// replied to, and one child per reactor, covering the time from when the
+// event was handed to the reactor until the reactor replied. Reactors that
+// haven't replied by reactorSpanGrace after the root span ends have their
+// spans ended then, marked as not having replied.
+//
+// All the methods here are safe to call on a nil *eventTrace.
+type eventTrace struct {
+	root *trace.Span
+
+	mu       sync.Mutex
+	reactors map[ReactorName]*trace.Span
+}
+
+func (h *Hub) startEventTrace(event *Event) {
+	if h.tracer == nil {
+		return
+	}
+
+	root := h.tracer.StartRoot("event", event.created,
+		trace.Int("event.id", int64(event.id)),
+		trace.String("event.bus", string(event.SourceBus)),
+		trace.String("event.sender", event.Sender),
+	)
+
+	et := &eventTrace{
+		root:     root,
+		reactors: make(map[ReactorName]*trace.Span),
+	}
+
+	event.trace = et
+	event.ctx = trace.ContextWithSpan(event.ctx, root)
+
+	context.AfterFunc(event.ctx, et.finish)
+}
+
+func (et *eventTrace) startDispatch() *trace.Span {
+	if et == nil {
+		return nil
+	}
+
+	return et.root.StartChild("hub.dispatch")
+}
+
+func (et *eventTrace) reactorStarted(name ReactorName) {
+	if et == nil {
+		return
+	}
+
+	et.mu.Lock()
+	defer et.mu.Unlock()
+
+	et.reactors[name] = et.root.StartChild("reactor", trace.String("reactor", string(name)))
+}
+
+func (et *eventTrace) reactorReplied(name ReactorName) {
+	if et == nil {
+		return
+	}
+
+	et.mu.Lock()
+	defer et.mu.Unlock()
+
+	span := et.reactors[name]
+	span.SetAttributes(trace.Bool("replied", true))
+	span.End()
+	delete(et.reactors, name)
+}
+
+func (et *eventTrace) finish() {
+	et.root.End()
+	time.AfterFunc(reactorSpanGrace, et.endUnreplied)
+}
+
+func (et *eventTrace) endUnreplied() {
+	et.mu.Lock()
+	defer et.mu.Unlock()
+
+	for name, span := range et.reactors {
+		span.SetAttributes(trace.Bool("replied", false))
+		span.End()
+		delete(et.reactors, name)
+	}
+}
+
+func (et *eventTrace) context(ctx context.Context) context.Context {
+	if et == nil {
+		return ctx
+	}
+
+	return trace.ContextWithSpan(ctx, et.root)
+}
+
+// TraceContext returns ctx, carrying the event's trace span (if it's being
+// traced), so that work done on the event's behalf can be traced with
+// trace.Start.
+func (e *Event) TraceContext(ctx context.Context) context.Context {
+	return e.trace.context(ctx)
+}
+
+// TraceContext returns ctx, carrying the trace span of the event this is a
+// reply to. Buses should pass this to SendMessage, so that sending the reply
+// shows up in the event's trace.
+func (r Reply) TraceContext(ctx context.Context) context.Context {
+	return r.trace.context(ctx)
+}
@@ -0,0 +1,103 @@
+package marvin_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mmcclimon/marvin"
+	"github.com/mmcclimon/marvin/marvintest"
+	"github.com/mmcclimon/marvin/registry"
+)
+
+type exportedSpan struct {
+	TraceID  string         `json:"trace_id"`
+	SpanID   string         `json:"span_id"`
+	ParentID string         `json:"parent_id"`
+	Name     string         `json:"name"`
+	Attrs    map[string]any `json:"attrs"`
+}
+
+func TestEventTrace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+
+	hub := marvintest.StartHub(t, fmt.Sprintf(`
+		[bus.test]
+		type = "marvintest"
+
+		[reactor.echo]
+		type = "echo"
+
+		[tracing]
+		exporter = "file"
+		file = %q
+	`, path), registry.Known())
+
+	bus := hub.Bus("test")
+	bus.Send("hello", marvintest.WithSender("arthur"))
+	bus.ExpectReply("echo: >>> hello <<<")
+
+	// Spans are exported in batches, and the last one on shutdown.
+	if err := hub.Stop(); err != nil {
+		t.Fatalf("hub stopped with error: %s", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	spans := make(map[string]exportedSpan)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var span exportedSpan
+		if err := json.Unmarshal(scanner.Bytes(), &span); err != nil {
+			t.Fatalf("bad span %q: %s", scanner.Text(), err)
+		}
+
+		spans[span.Name] = span
+	}
+
+	root, ok := spans["event"]
+	if !ok {
+		t.Fatalf("no root span in %+v", spans)
+	}
+
+	if root.ParentID != "" || root.Attrs["event.bus"] != "test" || root.Attrs["event.sender"] != "arthur" {
+		t.Errorf("root span is wrong: %+v", root)
+	}
+
+	for _, name := range []string{"hub.dispatch", "reactor"} {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("no %s span in %+v", name, spans)
+			continue
+		}
+
+		if span.TraceID != root.TraceID || span.ParentID != root.SpanID {
+			t.Errorf("%s span isn't a child of the root: %+v", name, span)
+		}
+	}
+
+	if reactor := spans["reactor"]; reactor.Attrs["reactor"] != "echo" || reactor.Attrs["replied"] != true {
+		t.Errorf("reactor span is wrong: %+v", reactor)
+	}
+}
+
+func TestTracingConfig(t *testing.T) {
+	for _, cfg := range []string{
+		`exporter = "otlp"`,
+		`exporter = "carrier-pigeon"`,
+	} {
+		_, err := marvin.FromString("[tracing]\n"+cfg, registry.Known())
+		if err == nil {
+			t.Errorf("assembled a hub with bad tracing config %s", cfg)
+		}
+	}
+}
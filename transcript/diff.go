@@ -0,0 +1,53 @@
+package transcript
+
+import "strings"
+
+// Diff compares two transcripts line by line, and returns a diff showing
+// how to get from want to got: lines only in want are prefixed with "-",
+// lines only in got with "+", and lines in both with a space. If the
+// transcripts are the same, Diff returns the empty string.
+func Diff(want, got Transcript) string {
+	if want.String() == got.String() {
+		return ""
+	}
+
+	// This is the textbook longest-common-subsequence table; transcripts are
+	// small enough that we don't need to be clever.
+	lcs := make([][]int, len(want)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(got)+1)
+	}
+
+	for i := len(want) - 1; i >= 0; i-- {
+		for j := len(got) - 1; j >= 0; j-- {
+			switch {
+			case want[i] == got[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] >= lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var b strings.Builder
+	i, j := 0, 0
+
+	for i < len(want) || j < len(got) {
+		switch {
+		case i < len(want) && j < len(got) && want[i] == got[j]:
+			b.WriteString("  " + want[i].String() + "\n")
+			i++
+			j++
+		case j == len(got) || (i < len(want) && lcs[i+1][j] >= lcs[i][j+1]):
+			b.WriteString("- " + want[i].String() + "\n")
+			i++
+		default:
+			b.WriteString("+ " + got[j].String() + "\n")
+			j++
+		}
+	}
+
+	return b.String()
+}
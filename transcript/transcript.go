@@ -0,0 +1,107 @@
+// Package transcript reads and writes conversations in the same format the
+// term bus displays them: lines starting with "> " are said by the user,
+// and lines starting with "| " are said by the bot.
+//
+//	# comments and blank lines are ignored
+//	> uptime
+//	| Online for 0s
+package transcript
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// A Line is one thing said in a conversation, either by a user or by the
+// bot.
+type Line struct {
+	FromBot bool
+	Text    string
+}
+
+type Transcript []Line
+
+// A Turn is something a user said, along with everything the bot said in
+// response.
+type Turn struct {
+	Input   Line
+	Replies []Line
+}
+
+// Parse turns a string into a transcript. Leading whitespace, blank lines,
+// and lines starting with # are ignored, so transcripts can be indented
+// along with the test code around them. Lines that don't start with either
+// marker are taken to be from the user.
+func Parse(s string) Transcript {
+	var t Transcript
+
+	for _, raw := range strings.Split(s, "\n") {
+		line := strings.TrimSpace(raw)
+
+		switch {
+		case line == "", strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "|"):
+			t = append(t, Line{FromBot: true, Text: trimMarker(line)})
+		default:
+			t = append(t, Line{Text: trimMarker(line)})
+		}
+	}
+
+	return t
+}
+
+func ParseFile(path string) (Transcript, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(string(data)), nil
+}
+
+func trimMarker(line string) string {
+	line = strings.TrimPrefix(line, ">")
+	line = strings.TrimPrefix(line, "|")
+	return strings.TrimPrefix(line, " ")
+}
+
+// Turns splits the transcript up into turns. It's an error for the bot to
+// speak before the user has said anything.
+func (t Transcript) Turns() ([]Turn, error) {
+	var turns []Turn
+
+	for i, line := range t {
+		if !line.FromBot {
+			turns = append(turns, Turn{Input: line})
+			continue
+		}
+
+		if len(turns) == 0 {
+			return nil, fmt.Errorf("line %d: reply before any input", i+1)
+		}
+
+		last := &turns[len(turns)-1]
+		last.Replies = append(last.Replies, line)
+	}
+
+	return turns, nil
+}
+
+func (l Line) String() string {
+	if l.FromBot {
+		return "| " + l.Text
+	}
+
+	return "> " + l.Text
+}
+
+func (t Transcript) String() string {
+	lines := make([]string, len(t))
+	for i, line := range t {
+		lines[i] = line.String()
+	}
+
+	return strings.Join(lines, "\n")
+}